@@ -1,6 +1,10 @@
 package app
 
-import "github.com/mobius-scheduler/mobius/common"
+import (
+	"context"
+	"encoding/json"
+	"github.com/mobius-scheduler/mobius/common"
+)
 
 type Application interface {
 	Init(AppConfig)
@@ -9,10 +13,68 @@ type Application interface {
 	Update([]common.TaskData, int)
 }
 
+// application that will reveal more tasks later,
+// even if it currently has no pending tasks
+type Upcoming interface {
+	HasUpcoming() bool
+}
+
+// application whose upcoming tasks arrive in wall-clock time (e.g., from
+// an external stream); Wait blocks until it has pending tasks, has no
+// more upcoming tasks, or ctx is done
+type Waiter interface {
+	Upcoming
+	Wait(ctx context.Context)
+}
+
+// application whose state can be saved in checkpoints
+type Snapshotter interface {
+	Snapshot() ([]byte, error)
+	Restore([]byte) error
+}
+
 type AppConfig struct {
 	AppID  int         `json:"app_id"`
 	Type   string      `json:"type"`
 	Config interface{} `json:"config"`
+	// entitlement in weighted alpha-fair utility (default 1)
+	Weight float64 `json:"weight"`
+	// minimum share of total allocation (optional, 0-1)
+	MinShare float64 `json:"min_share"`
+	// target share of total allocation (target_share objective)
+	TargetShare float64 `json:"target_share"`
+	// service-level agreement (optional)
+	SLA SLA `json:"sla"`
+}
+
+// service-level agreement of app (zero fields are not enforced)
+type SLA struct {
+	// minimum cumulative throughput (interest per hour)
+	MinTasksPerHour float64 `json:"min_tasks_per_hour"`
+	// maximum time a request may wait before being fulfilled
+	MaxWaitSec int `json:"max_wait_sec"`
+}
+
+// check if app has any guarantees
+func (s SLA) Enabled() bool {
+	return s.MinTasksPerHour > 0 || s.MaxWaitSec > 0
+}
+
+// entitlement of app (1 if unset)
+func (c AppConfig) GetWeight() float64 {
+	if c.Weight > 0 {
+		return c.Weight
+	}
+	return 1
+}
+
+// decode app-specific config into struct x
+func (c AppConfig) Decode(x interface{}) error {
+	bytes, err := json.Marshal(c.Config)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, x)
 }
 
 func MergeInterestMaps(ims []common.InterestMap) common.InterestMap {
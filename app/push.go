@@ -0,0 +1,80 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/mobius-scheduler/mobius/common"
+	"sync"
+)
+
+// application that accepts tasks pushed from outside Mobius
+type Receiver interface {
+	Application
+	Push([]common.TaskData)
+}
+
+// app whose tasks are pushed by an external source (e.g., HTTP service)
+// safe for concurrent use
+type AppPush struct {
+	id           int
+	interest_map common.InterestMap
+	mu           sync.Mutex
+}
+
+func (a *AppPush) Init(cfg AppConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.id = cfg.AppID
+	a.interest_map = make(common.InterestMap)
+}
+
+func (a *AppPush) GetID() int {
+	return a.id
+}
+
+// return copy of pending tasks
+func (a *AppPush) GetInterestMap() common.InterestMap {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.interest_map.Copy()
+}
+
+// remove fulfilled tasks
+func (a *AppPush) Update(tasks []common.TaskData, time int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, t := range tasks {
+		delete(a.interest_map, t.GetTask())
+	}
+}
+
+// add pending tasks (app ID is overwritten with this app's ID)
+func (a *AppPush) Push(tasks []common.TaskData) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, t := range tasks {
+		t.AppID = a.id
+		a.interest_map[t.GetTask()] = t
+	}
+}
+
+// save pending tasks
+func (a *AppPush) Snapshot() ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return json.Marshal(a.interest_map.ToFile())
+}
+
+// restore pending tasks
+func (a *AppPush) Restore(b []byte) error {
+	var tasks common.InterestFile
+	if err := json.Unmarshal(b, &tasks); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.interest_map = make(common.InterestMap)
+	for _, t := range tasks {
+		a.interest_map[t.GetTask()] = t
+	}
+	return nil
+}
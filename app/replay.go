@@ -0,0 +1,215 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/common"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// config for replay app
+type ReplayConfig struct {
+	Path string `json:"path"`
+	// log format: csv or jsonl (default: from file extension)
+	Format string `json:"format"`
+}
+
+// app that replays a recorded log of tasks
+// tasks are revealed once their request time has passed
+type AppReplay struct {
+	id           int
+	cfg          ReplayConfig
+	log          []common.TaskData
+	next         int
+	interest_map common.InterestMap
+}
+
+func (a *AppReplay) Init(cfg AppConfig) {
+	a.id = cfg.AppID
+	a.interest_map = make(common.InterestMap)
+	if err := cfg.Decode(&a.cfg); err != nil {
+		log.Fatalf("[app] app %d: invalid replay config: %v", a.id, err)
+	}
+	if a.cfg.Format == "" {
+		a.cfg.Format = strings.TrimPrefix(filepath.Ext(a.cfg.Path), ".")
+	}
+
+	var err error
+	if a.log, err = load_task_log(a.cfg.Path, a.cfg.Format); err != nil {
+		log.Fatalf("[app] app %d: error loading task log %s: %v", a.id, a.cfg.Path, err)
+	}
+	for i := range a.log {
+		a.log[i].AppID = a.id
+	}
+	sort.SliceStable(a.log, func(i, j int) bool { return a.log[i].RequestTime < a.log[j].RequestTime })
+	log.Printf("[app] app %d: replaying %d tasks from %s", a.id, len(a.log), a.cfg.Path)
+
+	a.reveal(0)
+}
+
+func (a *AppReplay) GetID() int {
+	return a.id
+}
+
+func (a *AppReplay) GetInterestMap() common.InterestMap {
+	return a.interest_map
+}
+
+// check if log has tasks that are not yet revealed
+func (a *AppReplay) HasUpcoming() bool {
+	return a.next < len(a.log)
+}
+
+// remove fulfilled tasks, reveal tasks requested up to time
+func (a *AppReplay) Update(tasks []common.TaskData, time int) {
+	for _, t := range tasks {
+		delete(a.interest_map, t.GetTask())
+	}
+	a.reveal(time)
+}
+
+// add logged tasks with request time <= time to InterestMap
+func (a *AppReplay) reveal(time int) {
+	for ; a.next < len(a.log) && a.log[a.next].RequestTime <= time; a.next++ {
+		t := a.log[a.next]
+		a.interest_map[t.GetTask()] = t
+	}
+}
+
+// state of replay app in checkpoint
+type replay_snapshot struct {
+	Next    int                 `json:"next"`
+	Pending common.InterestFile `json:"pending"`
+}
+
+// save replay position and pending tasks
+func (a *AppReplay) Snapshot() ([]byte, error) {
+	return json.Marshal(replay_snapshot{Next: a.next, Pending: a.interest_map.ToFile()})
+}
+
+// restore replay position and pending tasks
+// (log is reloaded from config in Init)
+func (a *AppReplay) Restore(b []byte) error {
+	var snap replay_snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return err
+	}
+	if snap.Next > len(a.log) {
+		return fmt.Errorf("replay position %d beyond end of log (%d tasks)", snap.Next, len(a.log))
+	}
+	a.next = snap.Next
+	a.interest_map = make(common.InterestMap)
+	for _, t := range snap.Pending {
+		a.interest_map[t.GetTask()] = t
+	}
+	return nil
+}
+
+// load task log (csv or jsonl)
+func load_task_log(path, format string) ([]common.TaskData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch format {
+	case "jsonl":
+		return read_task_jsonl(file)
+	case "csv":
+		return read_task_csv(file)
+	default:
+		return nil, fmt.Errorf("format %s not supported", format)
+	}
+}
+
+// read one TaskData record per line
+func read_task_jsonl(r io.Reader) ([]common.TaskData, error) {
+	var tasks []common.TaskData
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var t common.TaskData
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, scanner.Err()
+}
+
+// read CSV with header; columns:
+// request_time, latitude, longitude, interest, task_time_seconds (required)
+// dest_latitude and dest_longitude (optional, both or neither),
+// earliest, latest (optional)
+func read_task_csv(r io.Reader) ([]common.TaskData, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// index columns by name
+	cols := make(map[string]int)
+	for i, name := range rows[0] {
+		cols[name] = i
+	}
+	for _, name := range []string{"request_time", "latitude", "longitude", "interest", "task_time_seconds"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("missing column %s", name)
+		}
+	}
+	// destination columns come in pairs
+	_, has_dest_lat := cols["dest_latitude"]
+	_, has_dest_lon := cols["dest_longitude"]
+	if has_dest_lat && !has_dest_lon {
+		return nil, fmt.Errorf("missing column dest_longitude")
+	}
+	if has_dest_lon && !has_dest_lat {
+		return nil, fmt.Errorf("missing column dest_latitude")
+	}
+	has_dest := has_dest_lat
+	_, has_earliest := cols["earliest"]
+	_, has_latest := cols["latest"]
+
+	tasks := make([]common.TaskData, 0, len(rows)-1)
+	for n, row := range rows[1:] {
+		var t common.TaskData
+		var errs [9]error
+		t.RequestTime, errs[0] = strconv.Atoi(row[cols["request_time"]])
+		t.Location.Latitude, errs[1] = strconv.ParseFloat(row[cols["latitude"]], 64)
+		t.Location.Longitude, errs[2] = strconv.ParseFloat(row[cols["longitude"]], 64)
+		t.Interest, errs[3] = strconv.ParseFloat(row[cols["interest"]], 64)
+		t.TaskTimeSeconds, errs[4] = strconv.ParseFloat(row[cols["task_time_seconds"]], 64)
+		if has_dest {
+			t.Destination.Latitude, errs[5] = strconv.ParseFloat(row[cols["dest_latitude"]], 64)
+			t.Destination.Longitude, errs[6] = strconv.ParseFloat(row[cols["dest_longitude"]], 64)
+		}
+		if has_earliest {
+			t.Earliest, errs[7] = strconv.Atoi(row[cols["earliest"]])
+		}
+		if has_latest {
+			t.Latest, errs[8] = strconv.Atoi(row[cols["latest"]])
+		}
+		for _, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %v", n+2, err)
+			}
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
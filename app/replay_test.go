@@ -0,0 +1,30 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadTaskCSVDestination(t *testing.T) {
+	csv := "request_time,latitude,longitude,interest,task_time_seconds,dest_latitude,dest_longitude\n" +
+		"5,42.36,-71.09,1,30,42.37,-71.08\n"
+	tasks, err := read_task_csv(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Destination.Latitude != 42.37 || tasks[0].Destination.Longitude != -71.08 {
+		t.Errorf("got %+v", tasks)
+	}
+}
+
+func TestReadTaskCSVHalfDestination(t *testing.T) {
+	missing := map[string]string{"dest_latitude": "dest_longitude", "dest_longitude": "dest_latitude"}
+	for col, other := range missing {
+		csv := "request_time,latitude,longitude,interest,task_time_seconds," + col + "\n" +
+			"5,42.36,-71.09,1,30,42.37\n"
+		_, err := read_task_csv(strings.NewReader(csv))
+		if err == nil || !strings.Contains(err.Error(), other) {
+			t.Errorf("%s alone: want error naming %s, got %v", col, other, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/mobius-scheduler/mobius/common"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// config for stream app
+type StreamConfig struct {
+	// source type: file (JSONL), pipe (named pipe) or unix (Unix socket)
+	Source string `json:"source"`
+	Path   string `json:"path"`
+}
+
+// app fed by an external stream of TaskData records (one JSON record per line)
+// tasks are pending until reported fulfilled in Update
+type AppStream struct {
+	AppPush
+	cfg      StreamConfig
+	listener net.Listener
+	// guards closed (set by Close, or when pipe fails)
+	stream_mu sync.Mutex
+	closed    bool
+	// signaled when tasks arrive or stream closes
+	arrived chan struct{}
+}
+
+func (a *AppStream) Init(cfg AppConfig) {
+	a.AppPush.Init(cfg)
+	a.arrived = make(chan struct{}, 1)
+	if err := cfg.Decode(&a.cfg); err != nil {
+		log.Fatalf("[app] app %d: invalid stream config: %v", cfg.AppID, err)
+	}
+
+	switch a.cfg.Source {
+	case "file":
+		// read all tasks up front
+		file, err := os.Open(a.cfg.Path)
+		if err != nil {
+			log.Fatalf("[app] app %d: error opening %s: %v", a.id, a.cfg.Path, err)
+		}
+		defer file.Close()
+		a.read(file)
+	case "pipe":
+		// read tasks as writers open pipe
+		go func() {
+			for !a.is_closed() {
+				file, err := os.Open(a.cfg.Path)
+				if err != nil {
+					log.Warnf("[app] app %d: stopped reading %s: %v", a.id, a.cfg.Path, err)
+					a.set_closed()
+					return
+				}
+				a.read(file)
+				file.Close()
+			}
+		}()
+	case "unix":
+		// read tasks from each client connection
+		os.Remove(a.cfg.Path)
+		l, err := net.Listen("unix", a.cfg.Path)
+		if err != nil {
+			log.Fatalf("[app] app %d: error listening on %s: %v", a.id, a.cfg.Path, err)
+		}
+		a.listener = l
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					log.Warnf("[app] app %d: stopped accepting connections: %v", a.id, err)
+					return
+				}
+				go func() {
+					defer conn.Close()
+					a.read(conn)
+				}()
+			}
+		}()
+	default:
+		log.Fatalf("[app] app %d: stream source %s not supported", a.id, a.cfg.Source)
+	}
+}
+
+// read TaskData records (JSONL) until EOF, adding them to pending tasks
+func (a *AppStream) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var t common.TaskData
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			log.Warnf("[app] app %d: skipping invalid task %q: %v", a.id, scanner.Text(), err)
+			continue
+		}
+		a.Push([]common.TaskData{t})
+		a.signal()
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warnf("[app] app %d: error reading stream: %v", a.id, err)
+	}
+}
+
+func (a *AppStream) is_closed() bool {
+	a.stream_mu.Lock()
+	defer a.stream_mu.Unlock()
+	return a.closed
+}
+
+func (a *AppStream) set_closed() {
+	a.stream_mu.Lock()
+	defer a.stream_mu.Unlock()
+	a.closed = true
+	a.signal()
+}
+
+// wake up waiter, if any
+func (a *AppStream) signal() {
+	select {
+	case a.arrived <- struct{}{}:
+	default:
+	}
+}
+
+// pipe and unix sources may deliver more tasks until closed
+// (file source is read up front)
+func (a *AppStream) HasUpcoming() bool {
+	return a.cfg.Source != "file" && !a.is_closed()
+}
+
+// block until tasks are pending, stream is closed, or ctx is done
+func (a *AppStream) Wait(ctx context.Context) {
+	for len(a.GetInterestMap()) == 0 && a.HasUpcoming() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.arrived:
+		}
+	}
+}
+
+// stop reading stream, and listening for connections (unix source),
+// removing socket file
+func (a *AppStream) Close() error {
+	a.set_closed()
+	if a.listener != nil {
+		return a.listener.Close()
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreamUnixUpcomingUntilClosed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	a := &AppStream{}
+	a.Init(AppConfig{AppID: 3, Config: map[string]interface{}{"source": "unix", "path": path}})
+	if !a.HasUpcoming() {
+		t.Fatal("open unix stream should have upcoming tasks")
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte(`{"location":{"latitude":1,"longitude":2},"interest":1}` + "\n"))
+	conn.Close()
+	for i := 0; i < 100 && len(a.GetInterestMap()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(a.GetInterestMap()); n != 1 {
+		t.Fatalf("got %d pending tasks, want 1", n)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if a.HasUpcoming() {
+		t.Error("closed stream should have no upcoming tasks")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+}
+
+func TestStreamFileNoUpcoming(t *testing.T) {
+	f, err := ioutil.TempFile("", "stream*.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"location":{"latitude":1,"longitude":2},"interest":1}` + "\n")
+	f.Close()
+
+	a := &AppStream{}
+	a.Init(AppConfig{AppID: 3, Config: map[string]interface{}{"source": "file", "path": f.Name()}})
+	if n := len(a.GetInterestMap()); n != 1 {
+		t.Fatalf("got %d pending tasks, want 1", n)
+	}
+	if a.HasUpcoming() {
+		t.Error("file stream is read up front, should have no upcoming tasks")
+	}
+}
@@ -11,6 +11,9 @@ type TaskData struct {
 	TaskTimeSeconds float64  `json:"task_time_seconds"`
 	RequestTime     int      `json:"request_time"`
 	FulfillTime     int      `json:"fulfill_time"`
+	// service time window (0 if unset)
+	Earliest int `json:"earliest"`
+	Latest   int `json:"latest"`
 }
 
 // extract task from TaskData
@@ -28,12 +31,11 @@ type InterestMap map[Task]TaskData
 type InterestFile []TaskData
 
 // convert InterestMap to InterestFile, where key is string
+// (tasks in canonical order)
 func (im InterestMap) ToFile() InterestFile {
 	interest_file := make(InterestFile, len(im))
-	idx := 0
-	for _, data := range im {
-		interest_file[idx] = data
-		idx++
+	for i, t := range im.GetTasks() {
+		interest_file[i] = im[t]
 	}
 	return interest_file
 }
@@ -73,6 +75,28 @@ func (im InterestMap) Reweight(w map[int]float64) InterestMap {
 	return imw
 }
 
+// shift time windows so that they are relative to time t
+// (tasks whose window has closed by time t are dropped)
+func (im InterestMap) ShiftWindows(t int) InterestMap {
+	ims := make(InterestMap)
+	for task, data := range im {
+		if data.Earliest > 0 {
+			data.Earliest = data.Earliest - t
+			if data.Earliest < 0 {
+				data.Earliest = 0
+			}
+		}
+		if data.Latest > 0 {
+			data.Latest = data.Latest - t
+			if data.Latest <= 0 {
+				continue
+			}
+		}
+		ims[task] = data
+	}
+	return ims
+}
+
 // filter InterestMap by app ID
 func (im InterestMap) FilterByApp(id int) InterestMap {
 	ima := make(InterestMap)
@@ -84,7 +108,7 @@ func (im InterestMap) FilterByApp(id int) InterestMap {
 	return ima
 }
 
-// get tasks (keys) in InterestMap
+// get tasks (keys) in InterestMap, in canonical order
 func (im InterestMap) GetTasks() []Task {
 	tasks := make([]Task, len(im))
 	i := 0
@@ -92,13 +116,14 @@ func (im InterestMap) GetTasks() []Task {
 		tasks[i] = t
 		i++
 	}
+	SortTasks(tasks)
 	return tasks
 }
 
 // get total interest in InterestMap
 func (im InterestMap) GetTotalInterest() float64 {
 	var total float64
-	for t, _ := range im {
+	for _, t := range im.GetTasks() {
 		total += im[t].Interest
 	}
 	return total
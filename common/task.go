@@ -1,6 +1,9 @@
 package common
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 const INVALID_LOC = -1
 
@@ -27,3 +30,29 @@ func (t Task) String() string {
 		t.RequestTime,
 	)
 }
+
+// canonical ordering of tasks (app, request time, location, destination)
+// used wherever tasks are serialized or iterated, so that runs are reproducible
+func (t Task) Less(u Task) bool {
+	if t.AppID != u.AppID {
+		return t.AppID < u.AppID
+	}
+	if t.RequestTime != u.RequestTime {
+		return t.RequestTime < u.RequestTime
+	}
+	if t.Location.Latitude != u.Location.Latitude {
+		return t.Location.Latitude < u.Location.Latitude
+	}
+	if t.Location.Longitude != u.Location.Longitude {
+		return t.Location.Longitude < u.Location.Longitude
+	}
+	if t.Destination.Latitude != u.Destination.Latitude {
+		return t.Destination.Latitude < u.Destination.Latitude
+	}
+	return t.Destination.Longitude < u.Destination.Longitude
+}
+
+// sort tasks in canonical order
+func SortTasks(tasks []Task) {
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Less(tasks[j]) })
+}
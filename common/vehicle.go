@@ -4,4 +4,51 @@ type Vehicle struct {
 	ID       int      `json:"id"`
 	Location Location `json:"location"`
 	Speed    float64  `json:"speed"`
+	// per-vehicle limits (optional; zero/empty uses global setting)
+	// capacity (total interest per route; requests on board for
+	// pickup-and-delivery solvers)
+	Capacity int `json:"capacity,omitempty"`
+	// time/energy budget of route (seconds, capped by horizon)
+	Budget int `json:"budget,omitempty"`
+	// apps this vehicle may serve (empty: all apps)
+	AllowedApps []int `json:"allowed_apps,omitempty"`
+	// scales task time at each task (e.g., slower loading for bikes)
+	ServiceTimeMultiplier float64 `json:"service_time_multiplier,omitempty"`
+}
+
+// check if vehicle may serve tasks of app
+func (v Vehicle) CanServe(app int) bool {
+	if len(v.AllowedApps) == 0 {
+		return true
+	}
+	for _, id := range v.AllowedApps {
+		if id == app {
+			return true
+		}
+	}
+	return false
+}
+
+// route budget of vehicle, given global budget b
+func (v Vehicle) GetBudget(b int) int {
+	if v.Budget > 0 && v.Budget < b {
+		return v.Budget
+	}
+	return b
+}
+
+// capacity of vehicle, given global capacity c (0 is unlimited)
+func (v Vehicle) GetCapacity(c int) int {
+	if v.Capacity > 0 {
+		return v.Capacity
+	}
+	return c
+}
+
+// time vehicle takes to complete task with nominal task time t
+func (v Vehicle) ServiceTime(t float64) float64 {
+	if v.ServiceTimeMultiplier > 0 {
+		return t * v.ServiceTimeMultiplier
+	}
+	return t
 }
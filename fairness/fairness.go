@@ -0,0 +1,248 @@
+package fairness
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// initial interest (in order to evaluate utility function)
+const EPSILON = 0.1
+
+// fairness objective over allocations (interest per app)
+type Utility interface {
+	// utility of allocation
+	Value(x map[int]float64) float64
+	// allocation maximizing utility on face {x : w.x = c}, over apps in w
+	Optimum(w map[int]float64, c float64) map[int]float64
+}
+
+// parameters of objectives (unused ones are ignored)
+type Params struct {
+	// alpha of alpha-fair utility
+	Alpha float64
+	// entitlement of apps (1 if unset)
+	Weights map[int]float64
+	// target shares of apps (target_share; normalized over apps)
+	Targets map[int]float64
+	// disagreement point of apps (nash; 0 if unset)
+	Disagreement map[int]float64
+}
+
+// create objective by name: alpha (default), proportional, nash, jain or
+// target_share
+func New(name string, p Params) (Utility, error) {
+	switch name {
+	case "", "alpha":
+		if p.Alpha <= 0 {
+			return nil, fmt.Errorf("[fairness] alpha-fair utility requires alpha > 0, got %v", p.Alpha)
+		}
+		return AlphaFair{Alpha: p.Alpha, Weights: p.Weights}, nil
+	case "proportional":
+		return Proportional{Weights: p.Weights}, nil
+	case "nash":
+		return Nash{Weights: p.Weights, Disagreement: p.Disagreement}, nil
+	case "jain":
+		return Jain{Weights: p.Weights}, nil
+	case "target_share":
+		var total float64
+		for _, id := range ids(p.Targets) {
+			total += math.Max(0, p.Targets[id])
+		}
+		if total <= 0 {
+			return nil, fmt.Errorf("[fairness] target_share requires target shares")
+		}
+		return TargetShare{Targets: p.Targets}, nil
+	}
+	return nil, fmt.Errorf("[fairness] objective %s not supported", name)
+}
+
+// entitlement of app (1 if unset)
+func weight(p map[int]float64, id int) float64 {
+	if w, ok := p[id]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// app ids of allocation, sorted
+// (sums run in this order, so that utilities are reproducible)
+func ids(x map[int]float64) []int {
+	keys := make([]int, 0, len(x))
+	for id := range x {
+		keys = append(keys, id)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// allocation proportional to v on face w.x = c (x = v * t)
+func scale_to_face(v, w map[int]float64, c float64) map[int]float64 {
+	var d float64
+	for _, id := range ids(v) {
+		d += w[id] * v[id]
+	}
+	x := make(map[int]float64)
+	for id := range w {
+		if d > 0 {
+			x[id] = v[id] * c / d
+		} else {
+			x[id] = 0
+		}
+	}
+	return x
+}
+
+// weighted alpha-fair utility: sum_i p_i * U_alpha(x_i), with
+// U_alpha(x) = x^(1-alpha) / (1-alpha) (log x if alpha is 1)
+type AlphaFair struct {
+	Alpha   float64
+	Weights map[int]float64
+}
+
+func (u AlphaFair) Value(x map[int]float64) float64 {
+	var v float64
+	for _, id := range ids(x) {
+		xi := x[id]
+		if xi <= 0 {
+			xi = EPSILON
+		}
+		if u.Alpha == 1 {
+			v += weight(u.Weights, id) * math.Log(xi)
+		} else {
+			v += weight(u.Weights, id) * math.Pow(xi, 1-u.Alpha) / (1 - u.Alpha)
+		}
+	}
+	return v
+}
+
+// maximizing sum_i p_i * U(x_i) s.t. w.x = c gives
+// x_i = (lambda * w_i / p_i)^(-1/alpha)
+func (u AlphaFair) Optimum(w map[int]float64, c float64) map[int]float64 {
+	var d float64
+	for _, id := range ids(w) {
+		d += math.Pow(w[id], 1-1/u.Alpha) * math.Pow(weight(u.Weights, id), 1/u.Alpha)
+	}
+	lambda := math.Pow(c/d, -u.Alpha)
+
+	x := make(map[int]float64)
+	for id, wi := range w {
+		x[id] = math.Pow(lambda*wi/weight(u.Weights, id), -1/u.Alpha)
+	}
+	return x
+}
+
+// weighted proportional fairness: sum_i p_i * log(x_i)
+// (alpha-fair utility with alpha 1)
+type Proportional struct {
+	Weights map[int]float64
+}
+
+func (u Proportional) Value(x map[int]float64) float64 {
+	return AlphaFair{Alpha: 1, Weights: u.Weights}.Value(x)
+}
+
+func (u Proportional) Optimum(w map[int]float64, c float64) map[int]float64 {
+	return AlphaFair{Alpha: 1, Weights: u.Weights}.Optimum(w, c)
+}
+
+// Nash bargaining solution: sum_i p_i * log(x_i - d_i), for disagreement
+// point d (gains below EPSILON count as EPSILON)
+type Nash struct {
+	Weights      map[int]float64
+	Disagreement map[int]float64
+}
+
+func (u Nash) Value(x map[int]float64) float64 {
+	var v float64
+	for _, id := range ids(x) {
+		v += weight(u.Weights, id) * math.Log(math.Max(EPSILON, x[id]-u.Disagreement[id]))
+	}
+	return v
+}
+
+// x_i = d_i + p_i * (c - w.d) / (w_i * sum_j p_j), i.e., surplus over
+// disagreement point is split in proportion to entitlement
+// (clamped at 0 if the face lies below the disagreement point)
+func (u Nash) Optimum(w map[int]float64, c float64) map[int]float64 {
+	surplus := c
+	var p float64
+	for _, id := range ids(w) {
+		surplus -= w[id] * u.Disagreement[id]
+		p += weight(u.Weights, id)
+	}
+	x := make(map[int]float64)
+	for id, wi := range w {
+		x[id] = math.Max(0, u.Disagreement[id]+weight(u.Weights, id)*surplus/(wi*p))
+	}
+	return x
+}
+
+// Jain's fairness index of entitlement-normalized allocation y_i = x_i / p_i:
+// (sum_i y_i)^2 / (n * sum_i y_i^2) (0 if nothing is allocated); index is
+// scale-invariant, so ties are left to total allocation
+type Jain struct {
+	Weights map[int]float64
+}
+
+func (u Jain) Value(x map[int]float64) float64 {
+	var sum, sq float64
+	for _, id := range ids(x) {
+		y := x[id] / weight(u.Weights, id)
+		sum += y
+		sq += y * y
+	}
+	if sq == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(x)) * sq)
+}
+
+// index is maximal (1) when allocation is proportional to entitlement
+func (u Jain) Optimum(w map[int]float64, c float64) map[int]float64 {
+	p := make(map[int]float64)
+	for id := range w {
+		p[id] = weight(u.Weights, id)
+	}
+	return scale_to_face(p, w, c)
+}
+
+// target shares (e.g., app 1 gets 60%): largest t such that every app
+// with a target gets at least t times its share, min_i x_i / s_i
+// (apps without target share do not count)
+type TargetShare struct {
+	Targets map[int]float64
+}
+
+// target shares, normalized over apps in x
+func (u TargetShare) shares(x map[int]float64) map[int]float64 {
+	var total float64
+	for _, id := range ids(x) {
+		total += math.Max(0, u.Targets[id])
+	}
+	s := make(map[int]float64)
+	for id := range x {
+		if total > 0 {
+			s[id] = math.Max(0, u.Targets[id]) / total
+		}
+	}
+	return s
+}
+
+func (u TargetShare) Value(x map[int]float64) float64 {
+	v := math.Inf(1)
+	for id, s := range u.shares(x) {
+		if s > 0 {
+			v = math.Min(v, x[id]/s)
+		}
+	}
+	if math.IsInf(v, 1) {
+		return 0
+	}
+	return v
+}
+
+// allocation in exact target shares
+func (u TargetShare) Optimum(w map[int]float64, c float64) map[int]float64 {
+	return scale_to_face(u.shares(w), w, c)
+}
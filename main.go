@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/mobius-scheduler/apps/aqi"
@@ -13,9 +14,19 @@ import (
 	"github.com/mobius-scheduler/mobius/app"
 	"github.com/mobius-scheduler/mobius/common"
 	"github.com/mobius-scheduler/mobius/mobius"
+	"github.com/mobius-scheduler/mobius/report"
+	"github.com/mobius-scheduler/mobius/routing"
+	"github.com/mobius-scheduler/mobius/service"
 	"github.com/mobius-scheduler/mobius/vrp"
 	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 const MAX_ROUNDS = 1000
@@ -25,6 +36,7 @@ type Config struct {
 	Mode           string           `json:"mode"`
 	Apps           AppList          `json:"apps"`
 	Alpha          float64          `json:"alpha"`
+	Objective      string           `json:"objective"`
 	Discount       float64          `json:"discount"`
 	Horizon        int              `json:"horizon"`
 	ReplanSec      int              `json:"replan_sec"`
@@ -34,8 +46,26 @@ type Config struct {
 	Dir            string           `json:"dir"`
 	Verbose        bool             `json:"verbose"`
 	Hull           bool             `json:"hull"`
+	ReuseHull      bool             `json:"reuse_hull"`
+	Parallelism    int              `json:"parallelism"`
+	GeoJSON        bool             `json:"geojson"`
 	TravelTimePath string           `json:"travel_time_path"`
+	TravelModel    string           `json:"travel_model"`
+	OSM            string           `json:"osm"`
+	SpeedProfile   string           `json:"speed_profile"`
+	MatrixCache    string           `json:"matrix_cache"`
 	Solver         string           `json:"solver"`
+	SolveTimeout   int              `json:"solve_timeout"`
+	RoundTimeout   int              `json:"round_timeout"`
+	Workers        int              `json:"workers"`
+	Addr           string           `json:"addr"`
+	MetricsAddr    string           `json:"metrics_addr"`
+	Resume         string           `json:"resume"`
+	Seed           int64            `json:"seed"`
+	Weights        map[int]float64  `json:"weights"`
+	MinShare       map[int]float64  `json:"min_share"`
+	Targets        map[int]float64  `json:"targets"`
+	SLA            map[int]app.SLA  `json:"sla"`
 }
 
 type AppList []string
@@ -44,8 +74,9 @@ func (a *AppList) String() string         { return fmt.Sprintf("%v ", *a) }
 func (a *AppList) Set(value string) error { *a = append(*a, value); return nil }
 
 // Create apps by reading from JSON task files
-func create_env(alist AppList) []app.Application {
+func create_env(alist AppList) ([]app.Application, []app.AppConfig) {
 	apps := make([]app.Application, len(alist))
+	acs := make([]app.AppConfig, len(alist))
 	for i, path := range alist {
 		var a app.Application
 		var ac app.AppConfig
@@ -65,14 +96,41 @@ func create_env(alist AppList) []app.Application {
 			a = &roof.AppRoof{}
 		case "lyft":
 			a = &lyft.AppLyft{}
+		case "push":
+			a = &app.AppPush{}
+		case "stream":
+			a = &app.AppStream{}
+		case "replay":
+			a = &app.AppReplay{}
 		default:
 			log.Fatalf("[main] app type %v not supported", ac.Type)
 		}
 		a.Init(ac)
 		apps[i] = a
+		acs[i] = ac
 	}
 
-	return apps
+	return apps, acs
+}
+
+// Set per-app scheduling parameters (weights, minimum and target shares, SLAs)
+func set_app_params(cfg *Config, acs []app.AppConfig) {
+	cfg.Weights = make(map[int]float64)
+	cfg.MinShare = make(map[int]float64)
+	cfg.Targets = make(map[int]float64)
+	cfg.SLA = make(map[int]app.SLA)
+	for _, ac := range acs {
+		cfg.Weights[ac.AppID] = ac.GetWeight()
+		if ac.MinShare > 0 {
+			cfg.MinShare[ac.AppID] = ac.MinShare
+		}
+		if ac.TargetShare > 0 {
+			cfg.Targets[ac.AppID] = ac.TargetShare
+		}
+		if ac.SLA.Enabled() {
+			cfg.SLA[ac.AppID] = ac.SLA
+		}
+	}
 }
 
 // Load vehicle from config file and replicate
@@ -94,6 +152,56 @@ func load_vehicles(path string, num int) []common.Vehicle {
 	}
 }
 
+// Create travel model from config
+func create_travel_model(cfg Config) vrp.TravelModel {
+	// (in matrix mode, ttpath is the output)
+	name := cfg.TravelModel
+	if name == "" && cfg.OSM != "" {
+		name = "road"
+	} else if name == "" && cfg.TravelTimePath != "" && cfg.Mode != "matrix" {
+		name = "matrix"
+	}
+
+	var model vrp.TravelModel
+	switch name {
+	case "", "equirectangular":
+		model = vrp.Equirectangular{}
+	case "haversine":
+		model = vrp.Haversine{}
+	case "manhattan":
+		model = vrp.Manhattan{}
+	case "matrix":
+		if cfg.TravelTimePath == "" {
+			log.Fatalf("[main] travel model matrix requires ttpath")
+		}
+		m, err := vrp.LoadTravelMatrix(cfg.TravelTimePath)
+		if err != nil {
+			log.Fatalf("[main] error loading travel time matrix: %v", err)
+		}
+		model = m
+	case "road":
+		if cfg.OSM == "" {
+			log.Fatalf("[main] travel model road requires osm")
+		}
+		g, err := routing.Load(cfg.OSM)
+		if err != nil {
+			log.Fatalf("[main] error loading road network: %v", err)
+		}
+		model = g
+	default:
+		log.Fatalf("[main] travel model %v not supported", name)
+	}
+
+	if cfg.SpeedProfile != "" {
+		p, err := vrp.LoadSpeedProfile(cfg.SpeedProfile, model)
+		if err != nil {
+			log.Fatalf("[main] error loading speed profile: %v", err)
+		}
+		model = p
+	}
+	return model
+}
+
 // Get vehicle home location
 func get_home(vehicles []common.Vehicle) []common.Location {
 	home := make([]common.Location, len(vehicles))
@@ -128,6 +236,109 @@ func save(dir string, im common.InterestMap, s vrp.Schedule, cfg Config) {
 	common.ToFile(dir+"/sched.json", s)
 }
 
+// Create scheduler from config
+func new_scheduler(
+	cfg Config,
+	apps []app.Application,
+	solver vrp.Solver,
+	home []common.Location,
+	dir string,
+	max_rounds int,
+	metrics *mobius.Metrics) *mobius.Scheduler {
+	return &mobius.Scheduler{
+		Applications: apps,
+		Vehicles:     cfg.Vehicles,
+		Home:         home,
+		Solver:       solver,
+		Alpha:        cfg.Alpha,
+		Objective:    cfg.Objective,
+		Targets:      cfg.Targets,
+		Discount:     cfg.Discount,
+		Weights:      cfg.Weights,
+		MinShare:     cfg.MinShare,
+		SLA:          cfg.SLA,
+		Horizon:      cfg.Horizon,
+		ReplanSec:    cfg.ReplanSec,
+		MaxRounds:    max_rounds,
+		Capacity:     cfg.Capacity,
+		RTH:          cfg.RTH,
+		Dir:          dir,
+		Hull:         cfg.Hull,
+		ReuseHull:    cfg.ReuseHull,
+		Parallelism:  cfg.Parallelism,
+		GeoJSON:      cfg.GeoJSON,
+		SolveTimeout: time.Duration(cfg.SolveTimeout) * time.Second,
+		RoundTimeout: time.Duration(cfg.RoundTimeout) * time.Second,
+		ResumeFrom:   cfg.Resume,
+		Metrics:      metrics,
+	}
+}
+
+// Compute report from run directory, and save it there
+// (report.json, report.md, and per-app and per-round tables as CSV)
+func write_report(dir string, replan int) {
+	rep, err := report.Load(dir, replan)
+	if err != nil {
+		log.Fatalf("[main] error computing report: %v", err)
+	}
+	common.ToFile(dir+"/report.json", rep)
+	if err := ioutil.WriteFile(dir+"/report.md", []byte(rep.Markdown()), 0644); err != nil {
+		log.Fatalf("[main] error writing report: %v", err)
+	}
+	for name, write := range map[string]func(io.Writer) error{
+		"report.csv":        rep.WriteCSV,
+		"report_rounds.csv": rep.WriteRoundsCSV,
+	} {
+		f, err := os.Create(dir + "/" + name)
+		if err != nil {
+			log.Fatalf("[main] error writing report: %v", err)
+		}
+		if err := write(f); err != nil {
+			log.Fatalf("[main] error writing report: %v", err)
+		}
+		f.Close()
+	}
+	fmt.Print(rep.Markdown())
+}
+
+// Export schedule file(s) as GeoJSON, next to each file (.geojson):
+// path is a schedule (.json) or a run directory, whose per-round
+// schedules (and search schedule) are exported
+func write_geojson(path string) {
+	paths := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		log.Fatalf("[main] error exporting GeoJSON: %v", err)
+	} else if info.IsDir() {
+		paths, _ = filepath.Glob(filepath.Join(path, "schedule_round*.json"))
+		if _, err := os.Stat(filepath.Join(path, "sched.json")); err == nil {
+			paths = append(paths, filepath.Join(path, "sched.json"))
+		}
+	}
+	for _, p := range paths {
+		var s vrp.Schedule
+		common.FromFile(p, &s)
+		common.ToFile(strings.TrimSuffix(p, filepath.Ext(p))+".geojson", s.GeoJSON())
+	}
+	log.Printf("[main] exported %d schedules as GeoJSON", len(paths))
+}
+
+// Serve scheduler and solver metrics (Prometheus text format), if enabled
+func serve_metrics(addr string) *mobius.Metrics {
+	if addr == "" {
+		return nil
+	}
+	metrics := mobius.NewMetrics()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go func() {
+		log.Printf("[main] serving metrics on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Fatalf("[main] error serving metrics: %v", err)
+		}
+	}()
+	return metrics
+}
+
 func main() {
 	var cfg Config
 	flag.Var(
@@ -139,7 +350,7 @@ func main() {
 		&cfg.Mode,
 		"mode",
 		"mobius",
-		"scheduler mode (i.e., search, trace, mobius)",
+		"scheduler mode (i.e., search, trace, mobius, serve, matrix, report, geojson)",
 	)
 	flag.Float64Var(
 		&cfg.Alpha,
@@ -147,6 +358,12 @@ func main() {
 		100.0,
 		"alpha value (controls fairness)",
 	)
+	flag.StringVar(
+		&cfg.Objective,
+		"objective",
+		"alpha",
+		"fairness objective (i.e., alpha, proportional, nash, jain, target_share)",
+	)
 	flag.Float64Var(
 		&cfg.Discount,
 		"discount",
@@ -189,17 +406,77 @@ func main() {
 		"",
 		"path to travel time (distance) matrix",
 	)
+	flag.StringVar(
+		&cfg.TravelModel,
+		"travel_model",
+		"",
+		"travel model (equirectangular, haversine, manhattan, matrix, road; default: road if osm is set, matrix if ttpath is set)",
+	)
+	flag.StringVar(
+		&cfg.OSM,
+		"osm",
+		"",
+		"path to OpenStreetMap extract (.osm, .xml or .pbf) for road travel model",
+	)
+	flag.StringVar(
+		&cfg.SpeedProfile,
+		"speed_profile",
+		"",
+		"path to time-of-day speed profile (applied on top of travel model)",
+	)
+	flag.StringVar(
+		&cfg.MatrixCache,
+		"matrix_cache",
+		"",
+		"directory of travel time matrices built for external solvers (default: temporary directory)",
+	)
 	flag.StringVar(
 		&cfg.Solver,
 		"solver",
 		"ortools",
-		"solver type (ortools, pdptw, gurobi)",
+		"solver type (ortools, pdptw, native, native_pdptw)",
+	)
+	flag.IntVar(
+		&cfg.Workers,
+		"workers",
+		0,
+		"number of persistent ortools solver processes (0 = new process per solver call)",
+	)
+	flag.IntVar(
+		&cfg.SolveTimeout,
+		"solve_timeout",
+		0,
+		"deadline for each solver call (seconds; 0 = no deadline)",
+	)
+	flag.IntVar(
+		&cfg.RoundTimeout,
+		"round_timeout",
+		0,
+		"wall-clock budget for frontier search in each round (seconds; 0 = no budget)",
+	)
+	flag.StringVar(
+		&cfg.Addr,
+		"addr",
+		":8080",
+		"listen address for HTTP service (serve mode)",
+	)
+	flag.StringVar(
+		&cfg.MetricsAddr,
+		"metrics_addr",
+		"",
+		"listen address for Prometheus metrics on /metrics (e.g., localhost:9090; empty = disabled)",
 	)
 	flag.StringVar(
 		&cfg.Dir,
 		"dir",
 		"",
-		"directory to save logs",
+		"directory to save logs (report, geojson modes: run directory to read; geojson also takes a schedule file)",
+	)
+	flag.StringVar(
+		&cfg.Resume,
+		"resume",
+		"",
+		"resume scheduler from checkpoint in directory",
 	)
 	flag.BoolVar(
 		&cfg.Hull,
@@ -207,6 +484,30 @@ func main() {
 		false,
 		"trace hull in each round",
 	)
+	flag.BoolVar(
+		&cfg.ReuseHull,
+		"reuse_hull",
+		false,
+		"carry hull points over from previous round to warm-start search",
+	)
+	flag.IntVar(
+		&cfg.Parallelism,
+		"parallelism",
+		0,
+		"max concurrent solver calls in hull construction (0 = number of CPUs)",
+	)
+	flag.BoolVar(
+		&cfg.GeoJSON,
+		"geojson",
+		false,
+		"save schedule of each round as GeoJSON",
+	)
+	flag.Int64Var(
+		&cfg.Seed,
+		"seed",
+		1,
+		"random seed (identical inputs and seed give identical schedules)",
+	)
 	flag.BoolVar(
 		&cfg.Verbose,
 		"verbose",
@@ -230,28 +531,79 @@ func main() {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	// report only reads run directory
+	if cfg.Mode == "report" {
+		if cfg.Dir == "" {
+			log.Fatalf("[main] report mode requires dir")
+		}
+		write_report(cfg.Dir, cfg.ReplanSec)
+		return
+	}
+
+	// geojson only reads schedules (traced along travel model)
+	if cfg.Mode == "geojson" {
+		if cfg.Dir == "" {
+			log.Fatalf("[main] geojson mode requires dir")
+		}
+		vrp.SetTravelModel(create_travel_model(cfg))
+		write_geojson(cfg.Dir)
+		return
+	}
+
+	// seed randomness
+	rand.Seed(cfg.Seed)
+
 	// load vehicles
 	cfg.Vehicles = load_vehicles(*vehicles_path, *vehicles_num)
 
 	// print config
 	log.Printf("%+v", cfg)
 
+	// set travel model shared by all solvers
+	vrp.SetTravelModel(create_travel_model(cfg))
+	if cfg.MatrixCache != "" {
+		vrp.SetMatrixCacheDir(cfg.MatrixCache)
+	}
+
 	// init apps, solver
-	apps := create_env(cfg.Apps)
+	apps, acs := create_env(cfg.Apps)
+	set_app_params(&cfg, acs)
 	var solver vrp.Solver
 	switch cfg.Solver {
 	case "ortools":
 		solver = &vrp.GoogleSolver{}
 	case "pdptw":
 		solver = &vrp.PdptwSolver{}
+	case "native":
+		solver = &vrp.NativeSolver{}
+	case "native_pdptw":
+		solver = &vrp.NativePdptwSolver{}
 	default:
 		log.Fatalf("[main] solver %v not supported", cfg.Solver)
 	}
 	if cfg.TravelTimePath != "" {
 		solver.SetTravelTimeMatrixPath(cfg.TravelTimePath)
+	} else if cfg.Solver == "ortools" || cfg.Solver == "pdptw" {
+		if err := vrp.CheckExternalFleet(cfg.Vehicles); err != nil {
+			log.Fatalf("[main] %v", err)
+		}
+	}
+
+	// keep solver processes alive across calls
+	if cfg.Workers > 0 {
+		var pool *vrp.WorkerPool
+		switch x := solver.(type) {
+		case *vrp.GoogleSolver:
+			pool = vrp.NewOrtoolsPool(cfg.Workers)
+			x.SetPool(pool)
+		default:
+			log.Fatalf("[main] solver %v does not support workers", cfg.Solver)
+		}
+		defer pool.Close()
 	}
 
 	home := get_home(cfg.Vehicles)
+	metrics := serve_metrics(cfg.MetricsAddr)
 
 	var rth []common.Location = nil
 	if cfg.RTH > 0 {
@@ -276,22 +628,27 @@ func main() {
 		}
 
 		// init scheduler and run
-		scheduler := mobius.Scheduler{
-			Applications: apps,
-			Vehicles:     cfg.Vehicles,
-			Home:         home,
-			Solver:       solver,
-			Alpha:        cfg.Alpha,
-			Discount:     cfg.Discount,
-			Horizon:      cfg.Horizon,
-			ReplanSec:    cfg.ReplanSec,
-			MaxRounds:    max_rounds,
-			Capacity:     cfg.Capacity,
-			RTH:          cfg.RTH,
-			Dir:          dir,
-			Hull:         cfg.Hull,
+		scheduler := new_scheduler(cfg, apps, solver, home, dir, max_rounds, metrics)
+		if err := scheduler.Run(context.Background()); err != nil {
+			log.Fatalf("[main] error running scheduler: %v", err)
+		}
+	case "serve":
+		// create directory
+		if cfg.Dir != "" {
+			dir = cfg.Dir + "/serve/"
+			create_dir(dir)
+			common.ToFile(dir+"/config.cfg", cfg)
 		}
-		scheduler.Run()
+
+		// run scheduler in real time, serve API
+		scheduler := new_scheduler(cfg, apps, solver, home, dir, 0, metrics)
+		go func() {
+			if err := scheduler.RunRealtime(context.Background()); err != nil {
+				log.Fatalf("[main] error running scheduler: %v", err)
+			}
+		}()
+		log.Printf("[main] serving on %s", cfg.Addr)
+		log.Fatal(http.ListenAndServe(cfg.Addr, service.New(scheduler).Handler()))
 	case "trace":
 		// create directory
 		if cfg.Dir != "" {
@@ -306,16 +663,28 @@ func main() {
 
 		// init mobius and run
 		sp := mobius.Mobius{
-			InterestMap: im,
-			Solver:      solver,
-			Vehicles:    cfg.Vehicles,
-			Horizon:     cfg.Horizon,
-			Capacity:    cfg.Capacity,
-			Alpha:       cfg.Alpha,
-			Dir:         dir,
-		}
-		sp.Init()
-		hull := sp.TraceFrontier()
+			InterestMap:  im,
+			Solver:       solver,
+			Vehicles:     cfg.Vehicles,
+			Horizon:      cfg.Horizon,
+			Capacity:     cfg.Capacity,
+			Alpha:        cfg.Alpha,
+			Objective:    cfg.Objective,
+			Targets:      cfg.Targets,
+			Weights:      cfg.Weights,
+			MinShare:     cfg.MinShare,
+			Dir:          dir,
+			SolveTimeout: time.Duration(cfg.SolveTimeout) * time.Second,
+			Parallelism:  cfg.Parallelism,
+			Metrics:      metrics,
+		}
+		if err := sp.Init(context.Background()); err != nil {
+			log.Fatalf("[main] error initializing mobius: %v", err)
+		}
+		hull, err := sp.TraceFrontier(context.Background())
+		if err != nil {
+			log.Fatalf("[main] error tracing frontier: %v", err)
+		}
 		log.Printf("[main] found hull with allocations: %v", hull)
 	case "search":
 		// create directory
@@ -331,15 +700,28 @@ func main() {
 
 		// init mobius and run
 		sp := mobius.Mobius{
-			InterestMap: im,
-			Solver:      solver,
-			Vehicles:    cfg.Vehicles,
-			Horizon:     cfg.Horizon,
-			Capacity:    cfg.Capacity,
-			Alpha:       cfg.Alpha,
-		}
-		sp.Init()
-		sol := sp.SearchFrontier()
+			InterestMap:  im,
+			Solver:       solver,
+			Vehicles:     cfg.Vehicles,
+			Horizon:      cfg.Horizon,
+			Capacity:     cfg.Capacity,
+			Alpha:        cfg.Alpha,
+			Objective:    cfg.Objective,
+			Targets:      cfg.Targets,
+			Weights:      cfg.Weights,
+			MinShare:     cfg.MinShare,
+			SolveTimeout: time.Duration(cfg.SolveTimeout) * time.Second,
+			RoundTimeout: time.Duration(cfg.RoundTimeout) * time.Second,
+			Parallelism:  cfg.Parallelism,
+			Metrics:      metrics,
+		}
+		if err := sp.Init(context.Background()); err != nil {
+			log.Fatalf("[main] error initializing mobius: %v", err)
+		}
+		sol, err := sp.SearchFrontier(context.Background())
+		if err != nil {
+			log.Fatalf("[main] error searching frontier: %v", err)
+		}
 		log.Printf("[main] found alpha-fair allocation: %v", sol)
 
 		// write InterestMap, schedule
@@ -347,6 +729,24 @@ func main() {
 			save(dir, im, sol, cfg)
 		}
 
+	case "matrix":
+		// write travel times between vehicles and pending tasks to ttpath
+		if cfg.TravelTimePath == "" {
+			log.Fatalf("[main] matrix mode requires ttpath")
+		}
+		var locs []common.Location
+		locs = append(locs, home...)
+		for _, t := range merge_ims(apps).GetTasks() {
+			locs = append(locs, t.Location)
+			if t.Destination != (common.Location{}) && t.Destination.Latitude != common.INVALID_LOC {
+				locs = append(locs, t.Destination)
+			}
+		}
+		if err := vrp.WriteTravelMatrix(cfg.TravelTimePath, locs, cfg.Vehicles[0]); err != nil {
+			log.Fatalf("[main] error writing travel time matrix: %v", err)
+		}
+		log.Printf("[main] wrote travel time matrix for %d locations to %s", len(locs), cfg.TravelTimePath)
+
 	default:
 		log.Fatalf("[main] mode %s not supported", cfg.Mode)
 	}
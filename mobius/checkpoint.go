@@ -0,0 +1,117 @@
+package mobius
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/app"
+	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/vrp"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// name of checkpoint file in run directory
+const CHECKPOINT_FILE = "checkpoint.json"
+
+// schema for scheduler checkpoint (written after each round)
+type Checkpoint struct {
+	Round      int              `json:"round"`
+	BudgetTime int              `json:"budget_time"`
+	TotalTime  int              `json:"total_time"`
+	Vehicles   []common.Vehicle `json:"vehicles"`
+	Allocation vrp.Allocation   `json:"allocation"`
+	Schedule   vrp.Schedule     `json:"schedule"`
+	// app ID --> app snapshot (apps implementing app.Snapshotter)
+	Apps map[int][]byte `json:"apps"`
+}
+
+// write checkpoint of scheduler state to run directory
+// (written to temporary file first, so that a crash never leaves a partial checkpoint)
+func (s *Scheduler) save_checkpoint() error {
+	s.mu.Lock()
+	cp := Checkpoint{
+		Round:      s.round,
+		BudgetTime: s.budget_time,
+		TotalTime:  s.total_time,
+		Vehicles:   append([]common.Vehicle{}, s.Vehicles...),
+		Allocation: make(vrp.Allocation),
+		Schedule:   s.schedule,
+		Apps:       make(map[int][]byte),
+	}
+	for id, a := range s.allocation {
+		cp.Allocation[id] = a
+	}
+	s.mu.Unlock()
+
+	for _, a := range s.Applications {
+		if snap, ok := a.(app.Snapshotter); ok {
+			b, err := snap.Snapshot()
+			if err != nil {
+				return fmt.Errorf("[mobius] error saving app %d: %v", a.GetID(), err)
+			}
+			cp.Apps[a.GetID()] = b
+		}
+	}
+
+	path := filepath.Join(s.Dir, CHECKPOINT_FILE)
+	if err := ioutil.WriteFile(path+".tmp", common.ToJSON(cp), 0644); err != nil {
+		return fmt.Errorf("[mobius] error writing checkpoint: %v", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// restore scheduler state from checkpoint in directory
+func (s *Scheduler) restore_checkpoint(dir string) error {
+	b, err := ioutil.ReadFile(filepath.Join(dir, CHECKPOINT_FILE))
+	if err != nil {
+		return fmt.Errorf("[mobius] error reading checkpoint: %v", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return fmt.Errorf("[mobius] error unmarshaling checkpoint: %v", err)
+	}
+	if len(cp.Vehicles) != len(s.Vehicles) {
+		return fmt.Errorf(
+			"[mobius] checkpoint has %d vehicles, expected %d",
+			len(cp.Vehicles),
+			len(s.Vehicles),
+		)
+	}
+
+	// restore apps
+	for _, a := range s.Applications {
+		snap, ok := a.(app.Snapshotter)
+		data, found := cp.Apps[a.GetID()]
+		if !ok || !found {
+			log.Warnf("[mobius] app %d: no snapshot, starting from initial state", a.GetID())
+			continue
+		}
+		if err := snap.Restore(data); err != nil {
+			return fmt.Errorf("[mobius] error restoring app %d: %v", a.GetID(), err)
+		}
+	}
+
+	// restore scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.round = cp.Round
+	s.budget_time = cp.BudgetTime
+	s.total_time = cp.TotalTime
+	s.started = time.Now().Add(-time.Duration(cp.TotalTime) * time.Second)
+	copy(s.Vehicles, cp.Vehicles)
+	for id, a := range cp.Allocation {
+		s.allocation[id] = a
+	}
+	s.schedule = cp.Schedule
+	log.Printf(
+		"[mobius] resumed from %s at round %d, time %d, allocation %v",
+		dir,
+		s.round,
+		s.total_time,
+		s.allocation,
+	)
+	return nil
+}
@@ -0,0 +1,208 @@
+package mobius
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upper bounds of solver latency buckets (seconds)
+var LATENCY_BUCKETS = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// latency histogram of one solver type
+type latency struct {
+	buckets []int
+	sum     float64
+	count   int
+}
+
+// scheduler and solver health, served in Prometheus text format
+// (methods are no-ops on nil, so metrics are optional)
+type Metrics struct {
+	mu sync.Mutex
+	// cumulative allocation, and pending tasks, per app
+	allocation map[int]float64
+	pending    map[int]int
+	// tasks fulfilled in last round, number of rounds
+	throughput float64
+	rounds     int
+	// solver calls, errors and latencies, per solver type
+	calls   map[string]int
+	errors  map[string]int
+	latency map[string]*latency
+	// points found on hull in last round; hull extensions that ended
+	// normally (no better schedule), and that failed (solver or face
+	// equation errors)
+	hull_points        int
+	extension_ends     int
+	extension_failures int
+	// busy fraction of replanning interval in last round, per vehicle
+	utilization []float64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		allocation: make(map[int]float64),
+		pending:    make(map[int]int),
+		calls:      make(map[string]int),
+		errors:     make(map[string]int),
+		latency:    make(map[string]*latency),
+	}
+}
+
+// solver type label (e.g., vrp.NativeSolver)
+func solver_label(solver interface{}) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", solver), "*")
+}
+
+// record solver call
+func (m *Metrics) observe_solve(solver string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[solver]++
+	if err != nil {
+		m.errors[solver]++
+	}
+	l, ok := m.latency[solver]
+	if !ok {
+		l = &latency{buckets: make([]int, len(LATENCY_BUCKETS))}
+		m.latency[solver] = l
+	}
+	sec := d.Seconds()
+	for i, b := range LATENCY_BUCKETS {
+		if sec <= b {
+			l.buckets[i]++
+		}
+	}
+	l.sum += sec
+	l.count++
+}
+
+// record end of hull extension, with find_extension error
+func (m *Metrics) extension_ended(err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if errors.Is(err, err_no_extension) {
+		m.extension_ends++
+	} else {
+		m.extension_failures++
+	}
+}
+
+// record state after round
+func (m *Metrics) observe_round(allocation map[int]float64, pending map[int]int, throughput float64, hull_points int, utilization []float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allocation = allocation
+	m.pending = pending
+	m.throughput = throughput
+	m.hull_points = hull_points
+	m.utilization = utilization
+	m.rounds++
+}
+
+// write metric header
+func write_header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sorted keys of map from label to value
+func sorted_labels(m map[string]int) []string {
+	labels := make([]string, 0, len(m))
+	for label := range m {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// write all metrics (in fixed order, with sorted labels)
+func (m *Metrics) Export(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	write_header(w, "mobius_app_allocation_total", "counter", "Cumulative allocation (tasks fulfilled) per app.")
+	var ids []int
+	for id := range m.allocation {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		fmt.Fprintf(w, "mobius_app_allocation_total{app=\"%d\"} %g\n", id, m.allocation[id])
+	}
+
+	write_header(w, "mobius_pending_tasks", "gauge", "Pending tasks per app in last round.")
+	ids = nil
+	for id := range m.pending {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		fmt.Fprintf(w, "mobius_pending_tasks{app=\"%d\"} %d\n", id, m.pending[id])
+	}
+
+	write_header(w, "mobius_rounds_total", "counter", "Scheduling rounds completed.")
+	fmt.Fprintf(w, "mobius_rounds_total %d\n", m.rounds)
+
+	write_header(w, "mobius_round_throughput", "gauge", "Tasks fulfilled in last round.")
+	fmt.Fprintf(w, "mobius_round_throughput %g\n", m.throughput)
+
+	write_header(w, "mobius_solver_calls_total", "counter", "Solver calls per solver type.")
+	for _, label := range sorted_labels(m.calls) {
+		fmt.Fprintf(w, "mobius_solver_calls_total{solver=\"%s\"} %d\n", label, m.calls[label])
+	}
+
+	write_header(w, "mobius_solver_errors_total", "counter", "Failed solver calls per solver type.")
+	for _, label := range sorted_labels(m.calls) {
+		fmt.Fprintf(w, "mobius_solver_errors_total{solver=\"%s\"} %d\n", label, m.errors[label])
+	}
+
+	write_header(w, "mobius_solver_latency_seconds", "histogram", "Solver call latency per solver type.")
+	for _, label := range sorted_labels(m.calls) {
+		l := m.latency[label]
+		for i, b := range LATENCY_BUCKETS {
+			fmt.Fprintf(w, "mobius_solver_latency_seconds_bucket{solver=\"%s\",le=\"%g\"} %d\n", label, b, l.buckets[i])
+		}
+		fmt.Fprintf(w, "mobius_solver_latency_seconds_bucket{solver=\"%s\",le=\"+Inf\"} %d\n", label, l.count)
+		fmt.Fprintf(w, "mobius_solver_latency_seconds_sum{solver=\"%s\"} %g\n", label, l.sum)
+		fmt.Fprintf(w, "mobius_solver_latency_seconds_count{solver=\"%s\"} %d\n", label, l.count)
+	}
+
+	write_header(w, "mobius_hull_points", "gauge", "Points found on convex hull in last round.")
+	fmt.Fprintf(w, "mobius_hull_points %d\n", m.hull_points)
+
+	write_header(w, "mobius_extension_ends_total", "counter", "Hull extensions that ended because no better schedule exists.")
+	fmt.Fprintf(w, "mobius_extension_ends_total %d\n", m.extension_ends)
+
+	write_header(w, "mobius_extension_failures_total", "counter", "Hull extensions that failed (solver or face equation errors).")
+	fmt.Fprintf(w, "mobius_extension_failures_total %d\n", m.extension_failures)
+
+	write_header(w, "mobius_vehicle_utilization", "gauge", "Busy fraction of replanning interval in last round, per vehicle.")
+	for i, u := range m.utilization {
+		fmt.Fprintf(w, "mobius_vehicle_utilization{vehicle=\"%d\"} %g\n", i, u)
+	}
+}
+
+// serve metrics (e.g., on /metrics)
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.Export(w)
+}
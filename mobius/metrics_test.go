@@ -0,0 +1,66 @@
+package mobius
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/vrp"
+)
+
+// fake solver that always fails
+type failing_solver struct {
+	*vrp.FakeSolver
+}
+
+func (f failing_solver) New() vrp.Solver {
+	return f
+}
+
+func (f failing_solver) Solve(ctx context.Context) (vrp.Schedule, error) {
+	return vrp.Schedule{}, errors.New("solver failed")
+}
+
+func TestSearchEndIsNotExtensionFailure(t *testing.T) {
+	sp := test_mobius(test_polygon, 2, 1, 1)
+	sp.Metrics = NewMetrics()
+	if err := sp.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sp.SearchFrontier(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := sp.Metrics.extension_failures; n != 0 {
+		t.Errorf("healthy search counted %d extension failures", n)
+	}
+
+	// face on frontier cannot be extended: normal end
+	face := []fpoint{face_point(vrp.Allocation{1: 10, 2: 0}), face_point(vrp.Allocation{1: 9.5, 2: 3})}
+	ends := sp.Metrics.extension_ends
+	sp.extend_hull_search(context.Background(), face, face)
+	if n := sp.Metrics.extension_ends; n != ends+1 {
+		t.Errorf("counted %d ends, want %d", n, ends+1)
+	}
+	if n := sp.Metrics.extension_failures; n != 0 {
+		t.Errorf("counted %d extension failures, want 0", n)
+	}
+
+	// solver error is a failure
+	face = []fpoint{face_point(vrp.Allocation{1: 10, 2: 0}), face_point(vrp.Allocation{1: 0, 2: 10})}
+	sp.Solver = failing_solver{sp.Solver.(*vrp.FakeSolver)}
+	sp.extend_hull_search(context.Background(), face, face)
+	if n := sp.Metrics.extension_failures; n != 1 {
+		t.Errorf("counted %d extension failures, want 1", n)
+	}
+
+	var b bytes.Buffer
+	sp.Metrics.Export(&b)
+	for _, line := range []string{fmt.Sprintf("mobius_extension_ends_total %d\n", ends+1), "mobius_extension_failures_total 1\n"} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("export lacks %q", line)
+		}
+	}
+}
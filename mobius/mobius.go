@@ -1,16 +1,21 @@
 package mobius
 
 import (
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/fairness"
 	"github.com/mobius-scheduler/mobius/vrp"
 	log "github.com/sirupsen/logrus"
 	"gonum.org/v1/gonum/mat"
 	"math"
+	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Mobius struct {
@@ -23,26 +28,59 @@ type Mobius struct {
 	Dir             string
 	Alpha           float64
 	Discount        float64
+	Weights         map[int]float64
+	MinShare        map[int]float64
+	Required        map[int]float64
+	SolveTimeout    time.Duration
+	RoundTimeout    time.Duration
+	Reuse           bool
+	Parallelism     int
+	Metrics         *Metrics
+	Objective       string
+	Targets         map[int]float64
 	app_ids         []int
 	num_apps        int
 	min_app_id      int
-	heuristics      map[string]vrp.Schedule
+	heuristics      bank
 	last_face       []fpoint
 	frontier_writer *csv.Writer
+	// guards frontier_writer (written by concurrent solves)
+	mu sync.Mutex
+	// bounds concurrent solver calls in hull construction
+	pool chan struct{}
+	// bounds concurrent branches of hull tracing (besides caller's)
+	branches chan struct{}
+	// points found on hull this round (updated atomically)
+	hull_points int64
+	// fairness objective of this round
+	util fairness.Utility
+	// hull points and final face of previous round, and those
+	// carried over (re-evaluated for this round)
+	prev_hull    []fpoint
+	prev_face    []fpoint
+	carried      []fpoint
+	carried_face []fpoint
 }
 
 // initial interest (in order to evaluate utility function)
-const EPSILON = 0.1
+const EPSILON = fairness.EPSILON
 
 // init mobius, compute warm start schedules
-func (s *Mobius) Init() {
+func (s *Mobius) Init(ctx context.Context) error {
 	s.app_ids = s.InterestMap.GetApps()
 	s.num_apps = len(s.app_ids)
 	if s.num_apps < 1 {
-		log.Fatalf("[mobius] found %d apps; must have at least 1", s.num_apps)
+		return fmt.Errorf("[mobius] found %d apps; must have at least 1", s.num_apps)
 	}
 	s.min_app_id = s.app_ids[0]
 
+	// objective over this round's weights (which SLAs may boost)
+	util, err := s.new_objective()
+	if err != nil {
+		return err
+	}
+	s.util = util
+
 	// setup logging: CSV of allocations
 	if s.Dir != "" {
 		s.frontier_writer = common.CreateCSVWriter(s.Dir + "/frontier.csv")
@@ -59,9 +97,18 @@ func (s *Mobius) Init() {
 	}
 
 	// compute warm start schedules
-	s.heuristics = make(map[string]vrp.Schedule)
-	s.warm_start()
+	// (previous round's hull points join heuristics bank)
+	s.pool = make(chan struct{}, s.parallelism())
+	s.branches = make(chan struct{}, s.parallelism()-1)
+	s.heuristics = make(bank)
 	s.last_face = nil
+	atomic.StoreInt64(&s.hull_points, 0)
+	s.carried = nil
+	s.carried_face = nil
+	if s.Reuse {
+		s.carry_hull()
+	}
+	return s.warm_start(ctx)
 }
 
 func (s *Mobius) get_csv_row(solver string, alloc vrp.Allocation) []string {
@@ -74,23 +121,89 @@ func (s *Mobius) get_csv_row(solver string, alloc vrp.Allocation) []string {
 	return row
 }
 
-// precompute schedules to bootstrap solver
-// we parallelize the computation
-func (s *Mobius) warm_start() {
-	if s.frontier_writer != nil {
-		defer s.frontier_writer.Flush()
+// max concurrent solver calls in hull construction (default: CPUs)
+func (s *Mobius) parallelism() int {
+	if s.Parallelism > 0 {
+		return s.Parallelism
+	}
+	return runtime.NumCPU()
+}
+
+// write allocation to frontier log (thread safe)
+func (s *Mobius) write_frontier(solver string, alloc vrp.Allocation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frontier_writer == nil {
+		return
+	}
+	s.frontier_writer.Write(s.get_csv_row(solver, alloc))
+	s.frontier_writer.Flush()
+}
+
+// bank of cached schedules (by label) that seed solver calls
+// (never written concurrently: branches of hull tracing extend copies)
+type bank map[string]vrp.Schedule
+
+// add schedule to heuristics bank
+func (s *Mobius) add_heuristic(label string, schedule vrp.Schedule) {
+	s.heuristics[label] = schedule
+}
+
+// labels of schedules in bank, sorted
+func (b bank) labels() []string {
+	labels := make([]string, 0, len(b))
+	for label := range b {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// copy of bank (for a branch of hull tracing)
+func (b bank) copy() bank {
+	c := make(bank, len(b))
+	for label, schedule := range b {
+		c[label] = schedule
+	}
+	return c
+}
+
+// add schedules of other bank (replacing those with same label)
+func (b bank) merge(o bank) {
+	for label, schedule := range o {
+		b[label] = schedule
+	}
+}
+
+// base solver for warm start heuristics
+// (reuse configured VRP solver, so that heuristics share its worker pool,
+// or avoid external solvers if native or fake)
+func (s *Mobius) heuristic_base() vrp.Solver {
+	switch s.Solver.(type) {
+	case *vrp.GoogleSolver, *vrp.NativeSolver, *vrp.NativePdptwSolver, *vrp.FakeSolver:
+		return s.Solver
 	}
+	return nil
+}
 
+// precompute schedules to bootstrap solver
+// we parallelize the computation
+// (goroutines only read s.Solver, which is shared as heuristic base)
+func (s *Mobius) warm_start(ctx context.Context) error {
 	type ws struct {
 		schedule vrp.Schedule
 		label    string
+		err      error
 	}
 	alphas := []float64{0.1, 0.25, 1.0, 5.0, 100.0}
+	rth := s.Solver.GetRTH()
+	tt_path := s.Solver.GetTravelTimeMatrixPath()
 	var c chan ws
-	if s.Solver.GetRTH() != nil {
+	if rth != nil {
 		c = make(chan ws, 2)
 	} else {
-		c = make(chan ws, 2+len(alphas))
+		// (plus roi for fairness objective)
+		c = make(chan ws, 3+len(alphas))
 	}
 	var wg sync.WaitGroup
 
@@ -99,17 +212,21 @@ func (s *Mobius) warm_start() {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			d := vrp.DedicateSolver{}
+			d := vrp.DedicateSolver{Base: s.heuristic_base()}
 			d.Set(
 				s.InterestMap,
 				s.InterestMap,
 				s.Vehicles,
 				s.Horizon,
 				s.Capacity,
-				s.Solver.GetRTH(),
+				rth,
 			)
-			d.SetTravelTimeMatrixPath(s.Solver.GetTravelTimeMatrixPath())
-			sched := d.Solve()
+			d.SetTravelTimeMatrixPath(tt_path)
+			sched, err := s.solve(ctx, &d)
+			if err != nil {
+				c <- ws{label: "dedicate", err: err}
+				return
+			}
 			log.Debugf(
 				"warm start: dedicate: %v, util %v",
 				sched.Allocation,
@@ -120,18 +237,25 @@ func (s *Mobius) warm_start() {
 	}
 
 	// max throughput schedule (standard VRP)
+	// (on new instance: other heuristics read s.Solver concurrently)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		s.Solver.Set(
+		solver := s.Solver.New()
+		solver.Set(
 			s.InterestMap,
 			s.InterestMap,
 			s.Vehicles,
 			s.Horizon,
 			s.Capacity,
-			s.Solver.GetRTH(),
+			rth,
 		)
-		sched := s.Solver.Solve()
+		solver.SetTravelTimeMatrixPath(tt_path)
+		sched, err := s.solve(ctx, solver)
+		if err != nil {
+			c <- ws{label: "maxthp", err: err}
+			return
+		}
 		log.Debugf(
 			"warm start: maxthp: %v, util %v",
 			sched.Allocation,
@@ -142,89 +266,188 @@ func (s *Mobius) warm_start() {
 
 	// roi for different alphas
 	// only works when no RTH
-	if s.Solver.GetRTH() == nil && s.Solver.GetTravelTimeMatrixPath() == "" {
+	if rth == nil && tt_path == "" {
 		for _, a := range alphas {
 			wg.Add(1)
 			go func(alpha float64) {
 				defer wg.Done()
-				solver := vrp.RoiSolver{Alpha: alpha}
+				solver := vrp.RoiSolver{Alpha: alpha, Base: s.heuristic_base()}
 				solver.Set(s.InterestMap, s.InterestMap, s.Vehicles, s.Horizon, 0, false)
-				sched := solver.Solve()
+				label := fmt.Sprintf("roi_alpha%v", alpha)
+				sched, err := s.solve(ctx, &solver)
+				if err != nil {
+					c <- ws{label: label, err: err}
+					return
+				}
 				log.Debugf(
 					"warm start: roi, alpha %v: %v, util %v",
 					alpha,
 					sched.Allocation,
 					s.utility(sched.Allocation),
 				)
-				c <- ws{schedule: sched, label: fmt.Sprintf("roi_alpha%v", alpha)}
+				c <- ws{schedule: sched, label: label}
 			}(a)
 		}
+
+		// roi for fairness objective, unless alpha-fair (covered above)
+		if s.Objective != "" && s.Objective != "alpha" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				solver := vrp.RoiSolver{Utility: s.objective(), Base: s.heuristic_base()}
+				solver.Set(s.InterestMap, s.InterestMap, s.Vehicles, s.Horizon, 0, false)
+				label := fmt.Sprintf("roi_%s", s.Objective)
+				sched, err := s.solve(ctx, &solver)
+				if err != nil {
+					c <- ws{label: label, err: err}
+					return
+				}
+				log.Debugf(
+					"warm start: roi, %s: %v, util %v",
+					s.Objective,
+					sched.Allocation,
+					s.utility(sched.Allocation),
+				)
+				c <- ws{schedule: sched, label: label}
+			}()
+		}
 	}
 
 	// wait for threads to finish
+	// heuristics are optional, but max throughput schedule is required
+	// (results are processed in order of label, so that the
+	// heuristics bank and frontier file are reproducible)
 	wg.Wait()
 	close(c)
+	var results []ws
 	for x := range c {
-		s.heuristics[x.label] = x.schedule
-		if s.frontier_writer != nil {
-			s.frontier_writer.Write(
-				s.get_csv_row(x.label, x.schedule.Allocation),
-			)
+		results = append(results, x)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].label < results[j].label })
+
+	var err error
+	for _, x := range results {
+		if x.err != nil {
+			log.Warnf("[mobius] warm start %s failed: %v", x.label, x.err)
+			if x.label == "maxthp" {
+				err = fmt.Errorf("[mobius] warm start failed: %v", x.err)
+			}
+			continue
 		}
+		s.add_heuristic(x.label, x.schedule)
+		s.write_frontier(x.label, x.schedule.Allocation)
 	}
+	return err
 }
 
-// compute alpha-utlitity of allocation
-func (s *Mobius) utility(a vrp.Allocation) float64 {
-	// incorporate historical interest
+// entitlement of app in utility (1 if unset)
+func (s *Mobius) weight(id int) float64 {
+	if w, ok := s.Weights[id]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// total shortfall of allocation below apps' minimum shares
+// (shares include discounted historical interest)
+// and below apps' required allocation in this round
+func (s *Mobius) shortfall(a vrp.Allocation) float64 {
+	var short float64
+	for _, id := range s.app_ids {
+		short += math.Max(0, s.Required[id]-a[id])
+	}
+	if len(s.MinShare) == 0 {
+		return short
+	}
+
 	h := make(vrp.Allocation)
+	var total float64
 	for _, id := range s.app_ids {
 		h[id] = s.Discount*s.Historical[id] + a[id]
+		total += h[id]
 	}
 
-	var u float64
-	if s.Alpha == 1 {
-		for _, x := range h {
-			if x > 0 {
-				u += math.Log(x)
-			} else {
-				u += math.Log(EPSILON)
-			}
-		}
-	} else {
-		for _, x := range h {
-			if x > 0 {
-				u += math.Pow(x, 1-s.Alpha) / (1 - s.Alpha)
-			} else {
-				u += math.Pow(EPSILON, 1-s.Alpha) / (1 - s.Alpha)
-			}
-		}
+	for _, id := range s.app_ids {
+		short += math.Max(0, s.MinShare[id]*total-h[id])
+	}
+	return short
+}
+
+// fairness objective (weighted alpha-fair utility by default), with
+// app weights as entitlements, and SLA requirements as disagreement point
+func (s *Mobius) new_objective() (fairness.Utility, error) {
+	weights := make(map[int]float64)
+	for _, id := range s.app_ids {
+		weights[id] = s.weight(id)
+	}
+	return fairness.New(s.Objective, fairness.Params{
+		Alpha:        s.Alpha,
+		Weights:      weights,
+		Targets:      s.Targets,
+		Disagreement: s.Required,
+	})
+}
+
+// objective of this round (built, and validated, by Init)
+func (s *Mobius) objective() fairness.Utility {
+	return s.util
+}
+
+// compute utility of allocation under fairness objective
+// (e.g., sum of w_i * U_alpha(x_i))
+func (s *Mobius) utility(a vrp.Allocation) float64 {
+	// incorporate historical interest
+	h := make(vrp.Allocation)
+	for _, id := range s.app_ids {
+		h[id] = s.Discount*s.Historical[id] + a[id]
 	}
-	return u
+	return s.objective().Value(h)
 }
 
 // compute weighted reward, according to weight vector applied on InterestMap
 func weighted_reward(w map[int]float64, allocation vrp.Allocation) float64 {
 	var reward float64
-	for id, _ := range allocation {
+	for _, id := range allocation.IDs() {
 		reward += w[id] * allocation[id]
 	}
 	return reward
 }
 
+// anything that computes a schedule
+// (heuristics such as RoiSolver do not implement full vrp.Solver)
+type schedule_solver interface {
+	Solve(context.Context) (vrp.Schedule, error)
+}
+
+// run solver, with per-call deadline (if set)
+func (s *Mobius) solve(ctx context.Context, solver schedule_solver) (vrp.Schedule, error) {
+	if s.SolveTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.SolveTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	schedule, err := solver.Solve(ctx)
+	s.Metrics.observe_solve(solver_label(solver), time.Since(start), err)
+	return schedule, err
+}
+
 // thread safe
-func compute_schedule_ts(w map[int]float64, solver vrp.Solver) vrp.Schedule {
-	schedule := solver.Solve()
+func compute_schedule_ts(ctx context.Context, w map[int]float64, solver vrp.Solver) (vrp.Schedule, error) {
+	schedule, err := solver.Solve(ctx)
+	if err != nil {
+		return vrp.Schedule{}, err
+	}
 	schedule.Stats.Weights = w
-	return schedule
+	return schedule, nil
 }
 
 // reweight interestmap and run VRP
-func (s *Mobius) compute_schedule(w map[int]float64) (vrp.Schedule, float64) {
+func (s *Mobius) compute_schedule(ctx context.Context, w map[int]float64, b bank) (vrp.Schedule, float64, error) {
 
 	// check that num weights == num apps
 	if len(w) != s.num_apps {
-		log.Fatalf(
+		return vrp.Schedule{}, 0, fmt.Errorf(
 			"[mobius] cannot reweight InterestMap: %d weights, %d apps",
 			len(w),
 			s.num_apps,
@@ -234,10 +457,19 @@ func (s *Mobius) compute_schedule(w map[int]float64) (vrp.Schedule, float64) {
 	solver := s.Solver.New()
 
 	imw := s.InterestMap.Reweight(w)
-	initial_schedule := s.choose_init_schedule(w)
+	initial_schedule := b.choose(w)
 	solver.Set(imw, s.InterestMap, s.Vehicles, s.Horizon, s.Capacity, s.Solver.GetRTH())
 	solver.SetInitialSchedule(initial_schedule)
-	schedule := solver.Solve()
+	s.pool <- struct{}{}
+	schedule, err := s.solve(ctx, solver)
+	<-s.pool
+	if err != nil {
+		return vrp.Schedule{}, 0, fmt.Errorf(
+			"[mobius] error computing schedule for weights %v: %v",
+			w,
+			err,
+		)
+	}
 
 	// assert that schedule improved
 	ok := assert_schedule_improved(w, schedule.Allocation, initial_schedule.Allocation)
@@ -257,43 +489,35 @@ func (s *Mobius) compute_schedule(w map[int]float64) (vrp.Schedule, float64) {
 	)
 
 	// write allocation to log
-	if s.frontier_writer != nil {
-		defer s.frontier_writer.Flush()
-		s.frontier_writer.Write(
-			s.get_csv_row(
-				"vrp",
-				schedule.Allocation,
-			),
-		)
-	}
+	s.write_frontier("vrp", schedule.Allocation)
 
 	schedule.Stats.Weights = w
 	schedule.Stats.Alpha = s.Alpha
 
-	return schedule, s.utility(schedule.Allocation)
+	return schedule, s.utility(schedule.Allocation), nil
 }
 
 // compute best (highest weighted reward) schedule
-// from `heuristics` (bank of cached schedules)
-func (s *Mobius) choose_init_schedule(w map[int]float64) vrp.Schedule {
+// from bank of cached schedules
+func (b bank) choose(w map[int]float64) vrp.Schedule {
 	type ws_schedule struct {
 		schedule        vrp.Schedule
 		weighted_reward float64
 	}
 
 	// compute weighted reward for each schedule
-	schedules := make([]ws_schedule, len(s.heuristics)+1)
-	var idx int
-	for _, h := range s.heuristics {
+	// (in order of label, so that ties are broken deterministically)
+	schedules := make([]ws_schedule, len(b)+1)
+	for idx, label := range b.labels() {
+		h := b[label]
 		schedules[idx] = ws_schedule{
 			schedule:        h,
 			weighted_reward: weighted_reward(w, h.Allocation),
 		}
-		idx++
 	}
 
 	// sort and choose best
-	sort.Slice(
+	sort.SliceStable(
 		schedules,
 		func(i, j int) bool {
 			return schedules[i].weighted_reward > schedules[j].weighted_reward
@@ -343,15 +567,25 @@ func extract_schedules(hull []fpoint) []vrp.Schedule {
 
 // init hull with single-app schedules
 // we parallelize, since each schedule is independent
-func (s *Mobius) init_hull() []fpoint {
-	var hull []fpoint
-	c := make(chan fpoint, len(s.app_ids))
+// (schedules carried from previous round are reused)
+func (s *Mobius) init_hull(ctx context.Context) ([]fpoint, error) {
+	// results are indexed by app, so that hull order does not
+	// depend on which solver finishes first
+	hull := make([]fpoint, len(s.app_ids))
+	errs := make([]error, len(s.app_ids))
 	var wg sync.WaitGroup
 
-	for _, id := range s.app_ids {
+	for k, id := range s.app_ids {
 		wg.Add(1)
-		go func(i int) {
+		go func(k, i int) {
 			defer wg.Done()
+
+			// reuse carried single-app schedule, if any
+			if c := s.carried_corner(i); c != nil {
+				hull[k] = *c
+				return
+			}
+
 			weights := make(map[int]float64)
 			for _, idx := range s.app_ids {
 				if idx == i {
@@ -360,27 +594,34 @@ func (s *Mobius) init_hull() []fpoint {
 					weights[idx] = 0.0
 				}
 			}
-			schedule, _ := s.compute_schedule(weights)
+			schedule, _, err := s.compute_schedule(ctx, weights, s.heuristics)
+			if err != nil {
+				errs[k] = err
+				return
+			}
 			// assert that initialization is useful
 			if schedule.Allocation[i] == 0 {
-				log.Fatalf("app %v, nothing allocated", i)
+				errs[k] = fmt.Errorf("[mobius] app %v, nothing allocated", i)
+				return
 			}
-			c <- fpoint{
+			hull[k] = fpoint{
 				schedule: schedule,
 				utility:  s.utility(schedule.Allocation),
 				weights:  weights,
 			}
-		}(id)
+		}(k, id)
 	}
 
 	// wait for threads to finish
 	wg.Wait()
-	close(c)
-	for x := range c {
-		hull = append(hull, x)
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return hull
+	atomic.AddInt64(&s.hull_points, int64(len(hull)))
+	return hull, nil
 }
 
 // compute equation of face
@@ -460,24 +701,32 @@ func (s *Mobius) weight_tag(w map[int]float64) string {
 }
 
 // find feasible extension to convex hull
-func (s *Mobius) find_extension(face []fpoint, hull []fpoint) (fpoint, error) {
+// find_extension error when face cannot be extended: no schedule beyond
+// it, or face is not on upper hull (normal end of hull construction)
+var err_no_extension = errors.New("no extension found")
+
+func (s *Mobius) find_extension(ctx context.Context, face []fpoint, hull []fpoint, b bank) (fpoint, error) {
 	// compute face equation
 	c, weights, err := s.compute_face_equation(face)
 	if err != nil {
-		return fpoint{}, errors.New(fmt.Sprintf("no extension found: %v", err))
+		return fpoint{}, fmt.Errorf("no extension found: %v", err)
 	}
 	if !valid_weights(weights) {
-		return fpoint{}, errors.New(fmt.Sprintf("no extension found (invalid weights): %v", err))
+		return fpoint{}, fmt.Errorf("%w (invalid weights %v)", err_no_extension, weights)
 	}
 	w := s.weight_vector_to_map(weights)
 
 	// reweight InterestMap and compute schedule
-	schedule, utility := s.compute_schedule(w)
+	schedule, utility, err := s.compute_schedule(ctx, w, b)
+	if err != nil {
+		return fpoint{}, fmt.Errorf("no extension found: %v", err)
+	}
 
 	wr := weighted_reward(w, schedule.Allocation)
 	if wr >= c && !contains(hull, schedule.Allocation) {
 		// add schedule to heuristic bank
-		s.heuristics["weight_"+s.weight_tag(w)] = schedule
+		b["weight_"+s.weight_tag(w)] = schedule
+		atomic.AddInt64(&s.hull_points, 1)
 
 		fp := fpoint{
 			schedule: schedule,
@@ -486,7 +735,7 @@ func (s *Mobius) find_extension(face []fpoint, hull []fpoint) (fpoint, error) {
 		}
 		return fp, nil
 	} else {
-		return fpoint{}, errors.New("no extension found: no better schedule")
+		return fpoint{}, fmt.Errorf("%w: no better schedule", err_no_extension)
 	}
 }
 
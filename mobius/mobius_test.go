@@ -0,0 +1,214 @@
+package mobius
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/vrp"
+)
+
+// pending tasks of apps 1..apps (n each, with unit interest)
+func test_interest_map(apps, n int) common.InterestMap {
+	im := make(common.InterestMap)
+	for id := 1; id <= apps; id++ {
+		for i := 0; i < n; i++ {
+			d := common.TaskData{
+				AppID:           id,
+				Location:        common.Location{Latitude: 42.36 + float64(i)*0.001, Longitude: -71.09 + float64(id)*0.001},
+				Interest:        1,
+				TaskTimeSeconds: 30,
+			}
+			im[d.GetTask()] = d
+		}
+	}
+	return im
+}
+
+func test_vehicles() []common.Vehicle {
+	home := common.Location{Latitude: 42.36, Longitude: -71.09}
+	return []common.Vehicle{{ID: 0, Location: home, Speed: 10}, {ID: 1, Location: home, Speed: 10}}
+}
+
+// Mobius over frontier of fake solver
+func test_mobius(f vrp.Frontier, apps int, alpha float64, parallelism int) *Mobius {
+	im := test_interest_map(apps, 20)
+	vs := test_vehicles()
+	solver := vrp.NewFakeSolver(f)
+	solver.Set(im, im, vs, 600, 0, nil)
+	return &Mobius{
+		InterestMap: im,
+		Solver:      solver,
+		Vehicles:    vs,
+		Horizon:     600,
+		Alpha:       alpha,
+		Parallelism: parallelism,
+	}
+}
+
+// hull point for allocation
+func face_point(a vrp.Allocation) fpoint {
+	return fpoint{schedule: vrp.Schedule{Allocation: a}}
+}
+
+// allocations of schedules
+func allocations(schedules []vrp.Schedule) []vrp.Allocation {
+	var a []vrp.Allocation
+	for _, s := range schedules {
+		a = append(a, s.Allocation)
+	}
+	return a
+}
+
+// fake solver that records peak number of concurrent solve calls
+type counting_solver struct {
+	*vrp.FakeSolver
+	active *int64
+	peak   *int64
+}
+
+func new_counting_solver(f *vrp.FakeSolver) *counting_solver {
+	return &counting_solver{FakeSolver: f, active: new(int64), peak: new(int64)}
+}
+
+func (c *counting_solver) New() vrp.Solver {
+	return &counting_solver{FakeSolver: c.FakeSolver.New().(*vrp.FakeSolver), active: c.active, peak: c.peak}
+}
+
+func (c *counting_solver) Solve(ctx context.Context) (vrp.Schedule, error) {
+	n := atomic.AddInt64(c.active, 1)
+	defer atomic.AddInt64(c.active, -1)
+	for {
+		p := atomic.LoadInt64(c.peak)
+		if n <= p || atomic.CompareAndSwapInt64(c.peak, p, n) {
+			break
+		}
+	}
+	// hold call, so that concurrent calls overlap
+	time.Sleep(time.Millisecond)
+	return c.FakeSolver.Solve(ctx)
+}
+
+// concave polygon: every point is a vertex of the frontier
+var test_polygon = vrp.PointFrontier{
+	{1: 10, 2: 0}, {1: 9.5, 2: 3}, {1: 8.5, 2: 5.5}, {1: 7.2, 2: 7.2},
+	{1: 5.5, 2: 8.5}, {1: 3, 2: 9.5}, {1: 0, 2: 10},
+}
+
+// warm start, hull initialization and tracing share heuristics bank,
+// frontier log and hull point count across goroutines; run with -race
+func TestConcurrentHullConstruction(t *testing.T) {
+	var first []vrp.Allocation
+	for run := 0; run < 3; run++ {
+		dir, err := ioutil.TempDir("", "mobius")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		sp := test_mobius(test_polygon, 2, 1, 4)
+		sp.Dir = dir
+		if err := sp.Init(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(sp.heuristics) == 0 {
+			t.Fatal("warm start added no heuristics")
+		}
+
+		// hull construction, with solver calls bounded by parallelism
+		solver := new_counting_solver(sp.Solver.(*vrp.FakeSolver))
+		sp.Solver = solver
+		hull, err := sp.init_hull(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hull) != 2 {
+			t.Fatalf("got %d corners, want 2", len(hull))
+		}
+		schedules, err := sp.TraceFrontier(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if peak := atomic.LoadInt64(solver.peak); peak > 4 {
+			t.Errorf("got %d concurrent solver calls, want at most 4", peak)
+		} else if peak < 2 {
+			t.Error("solver calls never overlapped")
+		}
+		if n := atomic.LoadInt64(&sp.hull_points); n < int64(len(schedules)) {
+			t.Errorf("counted %d hull points, traced %d", n, len(schedules))
+		}
+
+		// concurrent exploration does not change result
+		got := allocations(schedules)
+		if run == 0 {
+			first = got
+		} else if !reflect.DeepEqual(got, first) {
+			t.Errorf("run %d traced %v, first run traced %v", run, got, first)
+		}
+	}
+}
+
+// concurrent searches on separate instances share nothing
+func TestConcurrentSearches(t *testing.T) {
+	f := vrp.NormFrontier{Scale: map[int]float64{1: 10, 2: 5, 3: 8}, P: 2}
+	done := make(chan vrp.Allocation, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			sp := test_mobius(f, 3, 1, 3)
+			if err := sp.Init(context.Background()); err != nil {
+				t.Error(err)
+				done <- nil
+				return
+			}
+			s, err := sp.SearchFrontier(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			done <- s.Allocation
+		}()
+	}
+	var first vrp.Allocation
+	for i := 0; i < 4; i++ {
+		a := <-done
+		if i == 0 {
+			first = a
+			continue
+		}
+		for id, x := range first {
+			if math.Abs(a[id]-x) > 1e-9 {
+				t.Errorf("searches disagree: %v vs %v", a, first)
+				break
+			}
+		}
+	}
+}
+
+// branches of tracing extend copies of heuristics bank, so that hull and
+// bank do not depend on parallelism
+func TestTraceIndependentOfParallelism(t *testing.T) {
+	var hulls [][]vrp.Allocation
+	var labels [][]string
+	for _, p := range []int{1, 4} {
+		sp := test_mobius(test_polygon, 2, 1, p)
+		if err := sp.Init(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		schedules, err := sp.TraceFrontier(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hulls = append(hulls, allocations(schedules))
+		labels = append(labels, sp.heuristics.labels())
+	}
+	if !reflect.DeepEqual(hulls[0], hulls[1]) {
+		t.Errorf("parallelism 1 traced %v, parallelism 4 traced %v", hulls[0], hulls[1])
+	}
+	if !reflect.DeepEqual(labels[0], labels[1]) {
+		t.Errorf("parallelism 1 banked %v, parallelism 4 banked %v", labels[0], labels[1])
+	}
+}
@@ -0,0 +1,115 @@
+package mobius
+
+import (
+	"github.com/mobius-scheduler/mobius/vrp"
+	log "github.com/sirupsen/logrus"
+)
+
+// check if weights are over exactly the apps of this round
+func (s *Mobius) same_apps(w map[int]float64) bool {
+	if len(w) != s.num_apps {
+		return false
+	}
+	for _, id := range s.app_ids {
+		if _, ok := w[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// re-evaluate hull point of previous round against this round's
+// InterestMap and vehicles
+func (s *Mobius) carry_point(p fpoint) fpoint {
+	schedule := vrp.RemapSchedule(
+		p.schedule,
+		s.Solver,
+		s.InterestMap,
+		s.InterestMap,
+		s.Vehicles,
+		s.Horizon,
+		s.Capacity,
+		s.Solver.GetRTH(),
+	)
+	return fpoint{
+		schedule: schedule,
+		utility:  s.utility(schedule.Allocation),
+		weights:  p.weights,
+	}
+}
+
+// carry over hull points (and final face) of previous round:
+// fulfilled tasks are dropped, and routes start at current vehicle
+// positions; carried schedules join the heuristics bank, so that they
+// warm-start solver calls, and seed the hull search
+func (s *Mobius) carry_hull() {
+	s.carried_face = nil
+	for _, p := range s.prev_hull {
+		if !s.same_apps(p.weights) {
+			continue
+		}
+		fp := s.carry_point(p)
+		s.carried = append(s.carried, fp)
+		s.add_heuristic("carried_"+s.weight_tag(fp.weights), fp.schedule)
+		s.write_frontier("carried", fp.schedule.Allocation)
+	}
+	for _, p := range s.prev_face {
+		if !s.same_apps(p.weights) {
+			s.carried_face = nil
+			break
+		}
+		s.carried_face = append(s.carried_face, s.carry_point(p))
+	}
+	log.Debugf(
+		"[mobius] carried %d hull points, %d face points from previous round",
+		len(s.carried),
+		len(s.carried_face),
+	)
+}
+
+// carried hull point for single app (nil if none still allocates to it)
+func (s *Mobius) carried_corner(id int) *fpoint {
+	for i, p := range s.carried {
+		if p.schedule.Allocation[id] <= 0 {
+			continue
+		}
+		corner := true
+		for _, x := range s.app_ids {
+			if (x == id && p.weights[x] != 1) || (x != id && p.weights[x] != 0) {
+				corner = false
+			}
+		}
+		if corner {
+			return &s.carried[i]
+		}
+	}
+	return nil
+}
+
+// face to start hull search from: carried final face of previous round,
+// if it still spans a valid face (nil otherwise)
+func (s *Mobius) start_face() []fpoint {
+	if len(s.carried_face) < s.num_apps {
+		return nil
+	}
+	_, weights, err := s.compute_face_equation(s.carried_face)
+	if err != nil || !valid_weights(weights) {
+		return nil
+	}
+	return s.carried_face
+}
+
+// remember hull points (corners and extension points found by search)
+// and final face for next round
+// (search may end on face plus the last extension, which is dropped
+// from face, but kept in hull)
+func (s *Mobius) save_hull(hull, face []fpoint) {
+	if !s.Reuse {
+		return
+	}
+	if len(face) > s.num_apps {
+		face = face[:s.num_apps]
+	}
+	s.prev_hull = append([]fpoint{}, hull...)
+	s.prev_face = append([]fpoint{}, face...)
+}
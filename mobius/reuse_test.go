@@ -0,0 +1,105 @@
+package mobius
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/vrp"
+)
+
+// pickups and deliveries on route
+func count_pd(s vrp.Schedule) (int, int) {
+	var pickups, deliveries int
+	for _, r := range s.Routes {
+		for _, t := range r.Path {
+			if t.Destination.Latitude == common.INVALID_LOC {
+				deliveries++
+			} else {
+				pickups++
+			}
+		}
+	}
+	return pickups, deliveries
+}
+
+func TestCarriedHullKeepsDeliveries(t *testing.T) {
+	// pickup-and-delivery requests of apps 1 and 2
+	im := make(common.InterestMap)
+	for id := 1; id <= 2; id++ {
+		for i := 0; i < 3; i++ {
+			d := common.TaskData{
+				AppID:           id,
+				Location:        common.Location{Latitude: 42.36 + float64(i)*0.001, Longitude: -71.09 + float64(id)*0.001},
+				Destination:     common.Location{Latitude: 42.365 + float64(i)*0.001, Longitude: -71.09},
+				Interest:        1,
+				TaskTimeSeconds: 30,
+			}
+			im[d.GetTask()] = d
+		}
+	}
+	vs := test_vehicles()
+	solver := vrp.NewNativePdptwSolver(im, im, vs, 1800, 0, nil)
+	schedule, err := solver.Solve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pickups, deliveries := count_pd(schedule)
+	if pickups == 0 || deliveries != pickups {
+		t.Fatalf("solver routed %d pickups, %d deliveries", pickups, deliveries)
+	}
+
+	// carry hull point of previous round into round with same tasks
+	sp := &Mobius{
+		InterestMap: im,
+		Solver:      solver,
+		Vehicles:    vs,
+		Horizon:     1800,
+		Alpha:       1,
+		Reuse:       true,
+		Parallelism: 1,
+	}
+	sp.prev_hull = []fpoint{{schedule: schedule, weights: map[int]float64{1: 1, 2: 1}}}
+	if err := sp.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sp.carried) != 1 {
+		t.Fatalf("carried %d hull points, want 1", len(sp.carried))
+	}
+	p, d := count_pd(sp.carried[0].schedule)
+	if p != pickups || d != deliveries {
+		t.Errorf("carried %d pickups, %d deliveries; want %d, %d", p, d, pickups, deliveries)
+	}
+}
+
+func TestSaveHullKeepsExtensionPoints(t *testing.T) {
+	sp := test_mobius(vrp.NormFrontier{Scale: map[int]float64{1: 10, 2: 5}, P: 2}, 2, 3, 1)
+	sp.Reuse = true
+	if err := sp.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sp.SearchFrontier(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// corners, and every extension point of search (once each)
+	var extensions int
+	seen := make(map[string]bool)
+	for _, p := range sp.prev_hull {
+		tag := sp.weight_tag(p.weights)
+		if seen[tag] {
+			t.Errorf("saved hull point for weights %v twice", p.weights)
+		}
+		seen[tag] = true
+		if p.weights[1] != 0 && p.weights[2] != 0 {
+			extensions++
+		}
+	}
+	if n := atomic.LoadInt64(&sp.hull_points); extensions != int(n)-2 {
+		t.Errorf("saved %d extension points, search found %d", extensions, n-2)
+	}
+	if extensions < 2 {
+		t.Errorf("saved %d extension points, want several", extensions)
+	}
+}
@@ -1,11 +1,18 @@
 package mobius
 
 import (
+	"context"
 	"fmt"
 	"github.com/mobius-scheduler/mobius/app"
 	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/fairness"
 	"github.com/mobius-scheduler/mobius/vrp"
 	log "github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // schema for Mobius scheduler
@@ -15,7 +22,12 @@ type Scheduler struct {
 	Home         []common.Location
 	Solver       vrp.Solver
 	Alpha        float64
+	Objective    string
+	Targets      map[int]float64
 	Discount     float64
+	Weights      map[int]float64
+	MinShare     map[int]float64
+	SLA          map[int]app.SLA
 	Horizon      int
 	ReplanSec    int
 	MaxRounds    int
@@ -23,8 +35,39 @@ type Scheduler struct {
 	RTH          int
 	Dir          string
 	Hull         bool
+	ReuseHull    bool
+	Parallelism  int
+	GeoJSON      bool
+	SolveTimeout time.Duration
+	RoundTimeout time.Duration
+	ResumeFrom   string
+	Metrics      *Metrics
 	interest_map common.InterestMap
 	allocation   vrp.Allocation
+	schedule     vrp.Schedule
+	sp           Mobius
+	round        int
+	budget_time  int
+	total_time   int
+	started      time.Time
+	// vehicles (by ID) whose position was reported during current round
+	reported map[int]bool
+	mu       sync.Mutex
+}
+
+// largest capacity of any vehicle (0 if some vehicle is unconstrained)
+func (s *Scheduler) max_capacity() int {
+	var c int
+	for _, v := range s.Vehicles {
+		vc := v.GetCapacity(s.Capacity)
+		if vc == 0 {
+			return 0
+		}
+		if vc > c {
+			c = vc
+		}
+	}
+	return c
 }
 
 // merge interest maps from all apps
@@ -37,12 +80,13 @@ func (s *Scheduler) get_interest_map() (common.InterestMap, common.InterestMap)
 	im_all := app.MergeInterestMaps(ims)
 
 	// enqueue tasks that violate capacity constraints
-	// add if there's balance
+	// (of largest vehicle); add if there's balance
+	capacity := s.max_capacity()
 	im := make(common.InterestMap)
 	for t, d := range im_all {
-		if s.Capacity > 0 && int(d.Interest) > s.Capacity {
-			d.Interest = float64(s.Capacity)
-			d.TaskTimeSeconds = float64(s.Capacity)
+		if capacity > 0 && int(d.Interest) > capacity {
+			d.Interest = float64(capacity)
+			d.TaskTimeSeconds = float64(capacity)
 		}
 		im[t] = d
 	}
@@ -51,12 +95,27 @@ func (s *Scheduler) get_interest_map() (common.InterestMap, common.InterestMap)
 }
 
 // update vehicle positions
+// (positions reported while round was solved are kept)
 func (s *Scheduler) update_vehicles(schedule vrp.Schedule) {
 	for i, route := range schedule.Routes {
+		if s.reported[s.Vehicles[i].ID] {
+			continue
+		}
 		s.Vehicles[i].Location = route.VehicleEnd
 	}
 }
 
+// copy of vehicles for solving a round
+// (positions reported from now on are tracked, and kept at end of round)
+func (s *Scheduler) round_vehicles() []common.Vehicle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reported = make(map[int]bool)
+	v := make([]common.Vehicle, len(s.Vehicles))
+	copy(v, s.Vehicles)
+	return v
+}
+
 // inform apps of completed tasks
 func (s *Scheduler) update_apps(schedule vrp.Schedule, im common.InterestMap, time int) {
 	// build map of completed tasks (by app)
@@ -76,160 +135,481 @@ func (s *Scheduler) update_apps(schedule vrp.Schedule, im common.InterestMap, ti
 	}
 }
 
-// run Mobius for multiple rounds
-func (s *Scheduler) Run() {
-	s.allocation = make(vrp.Allocation)
-	im_all, im := s.get_interest_map()
-	round := 0
-	budget_time := 0
-	total_time := 0
-
-	// init Mobius
-	sp := Mobius{
-		InterestMap: im,
-		Solver:      s.Solver,
-		Vehicles:    s.Vehicles,
-		Horizon:     s.Horizon,
-		Capacity:    s.Capacity,
-		Historical:  s.allocation,
-		Alpha:       s.Alpha,
-		Discount:    s.Discount,
-	}
-
-	// run scheduler in loop
-	for len(im_all) > 0 && round < s.MaxRounds {
-		// prepare solver, mobius
-		var rth []common.Location = nil
-		if s.RTH > 0 && budget_time+s.Horizon >= s.RTH {
-			log.Printf("[mobius] round %d, rth enabled", round)
-			rth = s.Home
-			budget_time = 0
-		}
-		total := 0.0
-		for _, a := range s.Applications {
-			total += a.GetInterestMap().GetTotalInterest()
-		}
-		log.Printf(
-			"[mobius] %v customers, %v tasks, %v vehicles",
-			len(s.Applications),
-			total,
-			len(s.Vehicles),
-		)
-
-		// update solver, scheduler params
-		s.Solver.Set(im, im, s.Vehicles, s.Horizon, s.Capacity, rth)
-		s.Solver.SetInitialSchedule(vrp.Schedule{})
-		sp.InterestMap = im
-		sp.Solver = s.Solver
-		sp.Vehicles = s.Vehicles
-		sp.Historical = s.allocation
-
-		// find schedule
-		// run mobius if alpha > 0, otherwise use solver
-		var schedule vrp.Schedule
-		var hull []vrp.Schedule
-		if s.Alpha > 0 {
-			sp.Init()
-			schedule = sp.SearchFrontier()
-			if s.Hull {
-				hull = sp.TraceFrontier()
+// compute schedule for current round
+// run mobius if alpha > 0, otherwise use solver
+func (s *Scheduler) compute_schedule(ctx context.Context, sp *Mobius, rth []common.Location) (vrp.Schedule, []vrp.Schedule, error) {
+	var schedule vrp.Schedule
+	var hull []vrp.Schedule
+	var err error
+	if s.Alpha > 0 {
+		if err = sp.Init(ctx); err != nil {
+			return schedule, nil, err
+		}
+		if schedule, err = sp.SearchFrontier(ctx); err != nil {
+			return schedule, nil, err
+		}
+		if s.Hull {
+			if hull, err = sp.TraceFrontier(ctx); err != nil {
+				log.Warnf("[mobius] error tracing hull: %v", err)
 			}
-		} else if s.Alpha == 0 {
-			schedule = s.Solver.Solve()
-		} else if s.Alpha == -1 {
-			var d vrp.Solver
-			switch x := (sp.Solver).(type) {
-			case *vrp.GoogleSolver:
-				d = &vrp.DedicateSolver{}
-				d.Set(
-					sp.InterestMap,
-					sp.InterestMap,
-					sp.Vehicles,
-					sp.Horizon,
-					sp.Capacity,
-					rth,
-				)
-				schedule = d.Solve()
-			case *vrp.PdptwSolver:
-				d = &vrp.DedicatePdptwSolver{}
-				d.Set(
-					sp.InterestMap,
-					sp.InterestMap,
-					sp.Vehicles,
-					sp.Horizon,
-					sp.Capacity,
-					rth,
-				)
-				d.SetTravelTimeMatrixPath(sp.Solver.GetTravelTimeMatrixPath())
-				schedule = d.Solve()
-			default:
-				log.Fatalf("[mobius] solver %v not supported", x)
+		}
+	} else if s.Alpha == 0 {
+		// weighted throughput
+		if len(sp.Weights) > 0 {
+			w := make(map[int]float64)
+			for _, id := range sp.InterestMap.GetApps() {
+				w[id] = sp.weight(id)
 			}
-		} else if s.Alpha == -2 {
-			r := vrp.RoundRobinSolver{}
-			r.Set(
-				sp.InterestMap,
+			s.Solver.Set(
+				sp.InterestMap.Reweight(w),
 				sp.InterestMap,
 				sp.Vehicles,
 				sp.Horizon,
 				sp.Capacity,
 				rth,
 			)
-			schedule = r.Solve()
 		}
-
-		log.Printf(
-			"[mobius] time %d-%d, allocation %+v",
-			total_time,
-			total_time+s.Horizon,
-			schedule.Allocation,
+		schedule, err = sp.solve(ctx, s.Solver)
+	} else if s.Alpha == -1 {
+		var d vrp.Solver
+		switch x := (sp.Solver).(type) {
+		case *vrp.GoogleSolver:
+			d = &vrp.DedicateSolver{}
+		case *vrp.PdptwSolver:
+			d = &vrp.DedicatePdptwSolver{}
+		case *vrp.NativeSolver:
+			d = &vrp.DedicateSolver{Base: x}
+		case *vrp.NativePdptwSolver:
+			d = &vrp.DedicateSolver{Base: x}
+		default:
+			return schedule, nil, fmt.Errorf("[mobius] solver %T not supported", x)
+		}
+		d.Set(
+			sp.InterestMap,
+			sp.InterestMap,
+			sp.Vehicles,
+			sp.Horizon,
+			sp.Capacity,
+			rth,
 		)
+		d.SetTravelTimeMatrixPath(sp.Solver.GetTravelTimeMatrixPath())
+		schedule, err = sp.solve(ctx, d)
+	} else if s.Alpha == -2 {
+		r := vrp.RoundRobinSolver{}
+		r.Set(
+			sp.InterestMap,
+			sp.InterestMap,
+			sp.Vehicles,
+			sp.Horizon,
+			sp.Capacity,
+			rth,
+		)
+		schedule, err = sp.solve(ctx, &r)
+	}
+	return schedule, hull, err
+}
 
-		// trim schedule
-		schedule.Trim(s.ReplanSec)
+// compute fallback schedule when solver fails:
+// use best schedule in heuristics bank, else native solver
+// (pickup-and-delivery variant, if solver is)
+func (s *Scheduler) fallback(ctx context.Context, sp *Mobius, rth []common.Location) (vrp.Schedule, error) {
+	if s.Alpha > 0 {
+		if schedule, err := sp.Fallback(); err == nil {
+			return schedule, nil
+		}
+	}
+	var solver vrp.Solver
+	switch sp.Solver.(type) {
+	case *vrp.PdptwSolver, *vrp.NativePdptwSolver:
+		solver = vrp.NewNativePdptwSolver(sp.InterestMap, sp.InterestMap, sp.Vehicles, sp.Horizon, sp.Capacity, rth)
+	default:
+		solver = vrp.NewNativeSolver(sp.InterestMap, sp.InterestMap, sp.Vehicles, sp.Horizon, sp.Capacity, rth)
+	}
+	return sp.solve(ctx, solver)
+}
 
-		// save interestmap, schedule
-		if s.Dir != "" {
-			common.ToFile(
-				fmt.Sprintf("%s/im_round%04d.json", s.Dir, round),
-				im_all.ToFile(),
-			)
-			common.ToFile(
-				fmt.Sprintf("%s/schedule_round%04d.json", s.Dir, round),
-				schedule,
-			)
+// reset scheduler state before first round
+// (or restore it from checkpoint, if resuming)
+func (s *Scheduler) start() error {
+	// check fairness objective up front (Mobius builds it every round,
+	// and would fall back on error)
+	if s.Alpha > 0 {
+		if _, err := fairness.New(s.Objective, fairness.Params{Alpha: s.Alpha, Targets: s.Targets}); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.allocation = make(vrp.Allocation)
+	s.schedule = vrp.Schedule{}
+	s.round = 0
+	s.budget_time = 0
+	s.total_time = 0
+	s.started = time.Now()
+
+	// init Mobius
+	s.sp = Mobius{
+		Solver:       s.Solver,
+		Horizon:      s.Horizon,
+		Capacity:     s.Capacity,
+		Historical:   s.allocation,
+		Alpha:        s.Alpha,
+		Objective:    s.Objective,
+		Targets:      s.Targets,
+		Discount:     s.Discount,
+		Weights:      s.Weights,
+		MinShare:     s.MinShare,
+		SolveTimeout: s.SolveTimeout,
+		RoundTimeout: s.RoundTimeout,
+		Reuse:        s.ReuseHull,
+		Parallelism:  s.Parallelism,
+	}
+	s.mu.Unlock()
+
+	if s.ResumeFrom != "" {
+		return s.restore_checkpoint(s.ResumeFrom)
+	}
+	return nil
+}
+
+// save checkpoint, if run directory is set
+func (s *Scheduler) checkpoint() error {
+	if s.Dir == "" {
+		return nil
+	}
+	return s.save_checkpoint()
+}
+
+// run a single round of scheduling
+func (s *Scheduler) step(ctx context.Context, im_all, im common.InterestMap) error {
+	round := s.round
+	total_time := s.total_time
+	sp := &s.sp
+
+	// prepare solver, mobius
+	var rth []common.Location = nil
+	if s.RTH > 0 && s.budget_time+s.Horizon >= s.RTH {
+		log.Printf("[mobius] round %d, rth enabled", round)
+		rth = s.Home
+		s.budget_time = 0
+	}
+	log.Printf(
+		"[mobius] %v customers, %v tasks, %v vehicles",
+		len(s.Applications),
+		im_all.GetTotalInterest(),
+		len(s.Vehicles),
+	)
+
+	// solvers see time windows (and travel times) relative to start of round
+	im = im.ShiftWindows(total_time)
+	vrp.SetTravelClock(total_time)
+
+	// update solver, scheduler params
+	// (solver gets a copy of vehicles, which may be updated concurrently)
+	vehicles := s.round_vehicles()
+	s.Solver.Set(im, im, vehicles, s.Horizon, s.Capacity, rth)
+	s.Solver.SetInitialSchedule(vrp.Schedule{})
+	sp.InterestMap = im
+	sp.Solver = s.Solver
+	sp.Vehicles = vehicles
+	sp.Historical = s.allocation
+	sp.Metrics = s.Metrics
+
+	// bias search toward apps at risk of violating SLAs
+	sp.Required = s.sla_requirements(im, total_time+s.ReplanSec)
+	sp.Weights = s.sla_weights(sp.Required)
+
+	// find schedule, fall back if solver fails
+	schedule, hull, err := s.compute_schedule(ctx, sp, rth)
+	if err != nil {
+		log.Warnf("[mobius] round %d, error computing schedule: %v", round, err)
+		schedule, err = s.fallback(ctx, sp, rth)
+		if err != nil {
+			return fmt.Errorf("[mobius] round %d, fallback failed: %v", round, err)
+		}
+	}
+
+	log.Printf(
+		"[mobius] time %d-%d, allocation %+v",
+		total_time,
+		total_time+s.Horizon,
+		schedule.Allocation,
+	)
+
+	// trim schedule
+	schedule.Trim(s.ReplanSec, vehicles)
+
+	// save interestmap, schedule
+	if s.Dir != "" {
+		common.ToFile(
+			fmt.Sprintf("%s/im_round%04d.json", s.Dir, round),
+			im_all.ToFile(),
+		)
+		common.ToFile(
+			fmt.Sprintf("%s/schedule_round%04d.json", s.Dir, round),
+			schedule,
+		)
+		common.ToFile(
+			fmt.Sprintf("%s/hull_round%04d.json", s.Dir, round),
+			hull,
+		)
+		if s.GeoJSON {
 			common.ToFile(
-				fmt.Sprintf("%s/hull_round%04d.json", s.Dir, round),
-				hull,
+				fmt.Sprintf("%s/schedule_round%04d.geojson", s.Dir, round),
+				schedule.GeoJSON(),
 			)
 		}
+	}
+
+	// update cumulative allocation, vehicle positions
+	s.mu.Lock()
+	for id, a := range schedule.Allocation {
+		s.allocation[id] += a
+	}
+	s.schedule = schedule
+	s.update_vehicles(schedule)
+	s.mu.Unlock()
+	log.Printf(
+		"[mobius] time %d-%d, round %d, allocation %+v",
+		total_time,
+		total_time+s.ReplanSec,
+		round,
+		schedule.Allocation,
+	)
 
-		// update cumulative allocation
-		total_alloc := 0.0
-		for id, a := range schedule.Allocation {
-			s.allocation[id] += a
-			total_alloc += a
+	log.Printf("round %d, cumulative allocation: %v", round, s.Allocation())
+	s.Metrics.observe_round(
+		s.Allocation(),
+		pending_tasks(im_all),
+		schedule.Allocation.Total(),
+		int(atomic.LoadInt64(&sp.hull_points)),
+		s.utilization(schedule),
+	)
+
+	// update applications, report SLA violations
+	s.update_apps(schedule, im, total_time)
+	s.check_sla(round, total_time+s.ReplanSec)
+
+	// update elapsed time
+	s.mu.Lock()
+	s.budget_time += s.ReplanSec
+	s.total_time += s.ReplanSec
+	s.round++
+	s.mu.Unlock()
+	return nil
+}
+
+// number of pending tasks per app
+func pending_tasks(im common.InterestMap) map[int]int {
+	pending := make(map[int]int)
+	for _, d := range im {
+		pending[d.AppID] += 1
+	}
+	return pending
+}
+
+// busy fraction of replanning interval, per vehicle (of trimmed schedule)
+func (s *Scheduler) utilization(schedule vrp.Schedule) []float64 {
+	u := make([]float64, len(schedule.Routes))
+	for i, route := range schedule.Routes {
+		if len(route.Path) == 0 || s.ReplanSec <= 0 {
+			continue
 		}
-		log.Printf(
-			"[mobius] time %d-%d, round %d, allocation %+v",
-			total_time,
-			total_time+s.ReplanSec,
-			round,
-			schedule.Allocation,
-		)
+		busy := route.Path[len(route.Path)-1].FulfillTime
+		u[i] = math.Min(1, float64(busy)/float64(s.ReplanSec))
+	}
+	return u
+}
+
+// check if any app will reveal tasks in future rounds
+func (s *Scheduler) has_upcoming() bool {
+	for _, a := range s.Applications {
+		if u, ok := a.(app.Upcoming); ok && u.HasUpcoming() {
+			return true
+		}
+	}
+	return false
+}
+
+// close apps holding external resources (e.g., stream sockets)
+func (s *Scheduler) close_apps() {
+	for _, a := range s.Applications {
+		if c, ok := a.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Warnf("[mobius] error closing app %d: %v", a.GetID(), err)
+			}
+		}
+	}
+}
+
+// apps with upcoming tasks, if all of them deliver tasks in wall-clock
+// time (nil otherwise)
+func (s *Scheduler) waiters() []app.Waiter {
+	var waiters []app.Waiter
+	for _, a := range s.Applications {
+		u, ok := a.(app.Upcoming)
+		if !ok || !u.HasUpcoming() {
+			continue
+		}
+		w, ok := a.(app.Waiter)
+		if !ok {
+			return nil
+		}
+		waiters = append(waiters, w)
+	}
+	return waiters
+}
 
-		log.Printf("round %d, cumulative allocation: %v", round, s.allocation)
+// advance time by one round without scheduling
+// (if only streams have upcoming tasks, advancing simulated time would not
+// bring them closer: wait until one delivers a task or closes instead)
+func (s *Scheduler) idle(ctx context.Context) error {
+	if waiters := s.waiters(); len(waiters) > 0 {
+		log.Printf("[mobius] round %d, waiting for streamed tasks", s.round)
+		wctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		done := make(chan struct{}, len(waiters))
+		for _, w := range waiters {
+			go func(w app.Waiter) {
+				w.Wait(wctx)
+				done <- struct{}{}
+			}(w)
+		}
+		<-done
+		return ctx.Err()
+	}
 
-		// update vehicle positions, applications
-		s.update_vehicles(schedule)
-		s.update_apps(schedule, im, total_time)
+	log.Printf("[mobius] round %d, no pending tasks", s.round)
+	for _, a := range s.Applications {
+		a.Update(nil, s.total_time+s.ReplanSec)
+	}
+	s.mu.Lock()
+	s.budget_time += s.ReplanSec
+	s.total_time += s.ReplanSec
+	s.round++
+	s.mu.Unlock()
+	return nil
+}
 
-		// update elapsed time
-		budget_time += s.ReplanSec
-		total_time += s.ReplanSec
+// run Mobius for multiple rounds (in simulated time)
+func (s *Scheduler) Run(ctx context.Context) error {
+	defer s.close_apps()
+	if err := s.start(); err != nil {
+		return err
+	}
 
-		// update im
-		im_all, im = s.get_interest_map()
-		round++
+	// run scheduler in loop
+	// (idle while waiting for upcoming tasks; returns ctx error if ctx is
+	// done while waiting for streamed tasks)
+	for s.round < s.MaxRounds {
+		im_all, im := s.get_interest_map()
+		if len(im_all) == 0 {
+			if !s.has_upcoming() {
+				break
+			}
+			if err := s.idle(ctx); err != nil {
+				return err
+			}
+		} else if err := s.step(ctx, im_all, im); err != nil {
+			return err
+		}
+		if err := s.checkpoint(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run Mobius until context is done, replanning every ReplanSec
+// (in wall-clock time); rounds without pending tasks are skipped
+func (s *Scheduler) RunRealtime(ctx context.Context) error {
+	defer s.close_apps()
+	if err := s.start(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(time.Duration(s.ReplanSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		s.total_time = int(time.Since(s.started).Seconds())
+		s.mu.Unlock()
+
+		im_all, im := s.get_interest_map()
+		if len(im_all) == 0 {
+			continue
+		}
+		if err := s.step(ctx, im_all, im); err != nil {
+			return err
+		}
+		if err := s.checkpoint(); err != nil {
+			return err
+		}
+	}
+}
+
+// current time (seconds since scheduler started)
+func (s *Scheduler) Now() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started.IsZero() {
+		return 0
+	}
+	return int(time.Since(s.started).Seconds())
+}
+
+// current round
+func (s *Scheduler) Round() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.round
+}
+
+// most recent (trimmed) schedule
+func (s *Scheduler) CurrentSchedule() vrp.Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.schedule
+}
+
+// copy of cumulative allocation
+func (s *Scheduler) Allocation() vrp.Allocation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := make(vrp.Allocation)
+	for id, x := range s.allocation {
+		a[id] = x
+	}
+	return a
+}
+
+// copy of vehicles (with current positions)
+func (s *Scheduler) GetVehicles() []common.Vehicle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := make([]common.Vehicle, len(s.Vehicles))
+	copy(v, s.Vehicles)
+	return v
+}
+
+// report vehicle position (used in next round)
+func (s *Scheduler) SetVehicleLocation(id int, loc common.Location) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.Vehicles {
+		if s.Vehicles[i].ID == id {
+			s.Vehicles[i].Location = loc
+			if s.reported != nil {
+				s.reported[id] = true
+			}
+			return nil
+		}
 	}
+	return fmt.Errorf("[mobius] vehicle %d not found", id)
 }
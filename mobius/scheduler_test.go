@@ -0,0 +1,204 @@
+package mobius
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mobius-scheduler/mobius/app"
+	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/vrp"
+)
+
+// push apps 1..apps, with n pending tasks each
+func test_push_apps(apps, n int) []app.Application {
+	im := test_interest_map(apps, n)
+	var as []app.Application
+	for id := 1; id <= apps; id++ {
+		a := &app.AppPush{}
+		a.Init(app.AppConfig{AppID: id})
+		var tasks []common.TaskData
+		for _, d := range im {
+			if d.AppID == id {
+				tasks = append(tasks, d)
+			}
+		}
+		a.Push(tasks)
+		as = append(as, a)
+	}
+	return as
+}
+
+func test_scheduler(apps []app.Application, rounds int) *Scheduler {
+	return &Scheduler{
+		Applications: apps,
+		Vehicles:     test_vehicles(),
+		Solver:       vrp.NewFakeSolver(vrp.NormFrontier{Scale: map[int]float64{1: 6, 2: 6}, P: 2}),
+		Alpha:        1,
+		Horizon:      600,
+		ReplanSec:    300,
+		MaxRounds:    rounds,
+		Parallelism:  1,
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	apps := test_push_apps(2, 20)
+	s := test_scheduler(apps, 3)
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := s.Round(); r != 3 {
+		t.Errorf("ran %d rounds, want 3", r)
+	}
+
+	// both apps are served, and apps drop tasks fulfilled in trimmed routes
+	a := s.Allocation()
+	for _, x := range apps {
+		id := x.GetID()
+		if a[id] <= 0 {
+			t.Errorf("app %d: got allocation %v, want positive share", id, a[id])
+		}
+		if done := 20 - len(x.GetInterestMap()); float64(done) < a[id] {
+			t.Errorf("app %d: %d tasks removed, %v allocated", id, done, a[id])
+		}
+	}
+}
+
+func TestSchedulerRunStopsWithoutTasks(t *testing.T) {
+	apps := test_push_apps(2, 2)
+	s := test_scheduler(apps, 10)
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := s.Round(); r >= 10 {
+		t.Errorf("ran all %d rounds, want stop once tasks are fulfilled", r)
+	}
+	for _, a := range apps {
+		if n := len(a.GetInterestMap()); n != 0 {
+			t.Errorf("app %d: %d tasks pending", a.GetID(), n)
+		}
+	}
+}
+
+func TestSchedulerRunWaitsForOpenStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+	a := &app.AppStream{}
+	a.Init(app.AppConfig{AppID: 1, Config: map[string]interface{}{"source": "unix", "path": path}})
+
+	s := test_scheduler([]app.Application{a}, 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	// open, empty stream: no rounds pass
+	time.Sleep(100 * time.Millisecond)
+	if r := s.Round(); r != 0 {
+		t.Fatalf("ran %d rounds without tasks", r)
+	}
+
+	// streamed task is scheduled
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte(`{"location":{"latitude":42.361,"longitude":-71.09},"interest":1,"task_time_seconds":30}` + "\n"))
+	conn.Close()
+	for i := 0; i < 100 && s.Round() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r := s.Round(); r != 1 {
+		t.Errorf("ran %d rounds after one streamed task, want 1", r)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("got %v, want context canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after context was canceled")
+	}
+}
+
+// fake solver whose first solve waits until released
+type blocking_solver struct {
+	*vrp.FakeSolver
+	started chan struct{}
+	release chan struct{}
+	once    *sync.Once
+}
+
+func (b *blocking_solver) Solve(ctx context.Context) (vrp.Schedule, error) {
+	b.once.Do(func() {
+		close(b.started)
+		<-b.release
+	})
+	return b.FakeSolver.Solve(ctx)
+}
+
+func TestSchedulerKeepsPositionReportedDuringSolve(t *testing.T) {
+	solver := &blocking_solver{
+		FakeSolver: vrp.NewFakeSolver(vrp.NormFrontier{Scale: map[int]float64{1: 6, 2: 6}, P: 2}),
+		started:    make(chan struct{}),
+		release:    make(chan struct{}),
+		once:       &sync.Once{},
+	}
+	s := test_scheduler(test_push_apps(2, 20), 1)
+	s.Solver = solver
+	s.Alpha = 0
+	home := s.Vehicles[0].Location
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(context.Background())
+	}()
+	<-solver.started
+	reported := common.Location{Latitude: 42.4, Longitude: -71.1}
+	if err := s.SetVehicleLocation(1, reported); err != nil {
+		t.Fatal(err)
+	}
+	close(solver.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// vehicle 0 moves to end of its route, vehicle 1 stays where reported
+	v := s.GetVehicles()
+	if v[0].Location == home {
+		t.Error("vehicle 0 did not move to end of its route")
+	}
+	if v[1].Location != reported {
+		t.Errorf("vehicle 1 at %v, want reported position %v", v[1].Location, reported)
+	}
+}
+
+func TestSchedulerRejectsUnknownObjective(t *testing.T) {
+	s := test_scheduler(test_push_apps(2, 2), 1)
+	s.Objective = "utilitarian"
+	if err := s.Run(context.Background()); err == nil {
+		t.Fatal("expected error for unknown objective")
+	}
+	if r := s.Round(); r != 0 {
+		t.Errorf("ran %d rounds with unknown objective", r)
+	}
+
+	sp := test_mobius(test_polygon, 2, 1, 1)
+	sp.Objective = "utilitarian"
+	if err := sp.Init(context.Background()); err == nil {
+		t.Error("Init accepted unknown objective")
+	}
+}
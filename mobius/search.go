@@ -1,36 +1,28 @@
 package mobius
 
 import (
+	"context"
 	"errors"
 	"github.com/mobius-scheduler/mobius/common"
 	"github.com/mobius-scheduler/mobius/vrp"
 	log "github.com/sirupsen/logrus"
-	"math"
 	"sort"
 )
 
-// compute lagrangian
-func (s *Mobius) compute_lagrangian(w map[int]float64, c float64) float64 {
-	var d float64
-	for _, weight := range w {
-		d += math.Pow(weight, 1-1/s.Alpha)
-	}
-	return math.Pow(c/d, -s.Alpha)
-}
-
 // compute value of optimal allocation
+// (maximizer of fairness objective on face with normal w and offset c)
 func (s *Mobius) compute_opt(face []fpoint) ([]float64, error) {
 	c, weights, err := s.compute_face_equation(face)
 	if err != nil {
 		return nil, errors.New("error computing face equation")
 	}
 	w := s.weight_vector_to_map(weights)
-	lambda := s.compute_lagrangian(w, c)
+	opt := s.objective().Optimum(w, c)
 
 	// compute opt
 	x_opt := make([]float64, s.num_apps)
 	for i, id := range s.app_ids {
-		x_opt[i] = math.Pow(lambda*w[id], -1/s.Alpha)
+		x_opt[i] = opt[id]
 	}
 	return x_opt, nil
 }
@@ -68,9 +60,15 @@ func (s *Mobius) eval_face(face []fpoint) bool {
 	return s.opt_in_face(x_opt, app_allocs)
 }
 
-// extend hull (in direction of alpha-fair solution)
-func (s *Mobius) extend_hull_search(face []fpoint, hull []fpoint) []fpoint {
+// extend hull (in direction of alpha-fair solution), returning final
+// face and hull with extension points found
+// stops extending (returning current face) once context is done
+func (s *Mobius) extend_hull_search(ctx context.Context, face []fpoint, hull []fpoint) ([]fpoint, []fpoint) {
 	s.assert_face_dim(face)
+	if err := ctx.Err(); err != nil {
+		log.Warnf("[mobius] stopping search: %v", err)
+		return face, hull
+	}
 
 	var alloc []vrp.Allocation
 	for _, f := range face {
@@ -78,13 +76,19 @@ func (s *Mobius) extend_hull_search(face []fpoint, hull []fpoint) []fpoint {
 	}
 
 	// find extension
-	fp, err := s.find_extension(face, hull)
+	fp, err := s.find_extension(ctx, face, hull, s.heuristics)
 	if err != nil {
-		log.Warnf("error %v", err)
-		return face
+		if errors.Is(err, err_no_extension) {
+			log.Debugf("[mobius] search ended: %v", err)
+		} else {
+			log.Warnf("[mobius] search stopped: %v", err)
+		}
+		s.Metrics.extension_ended(err)
+		return face, hull
 	} else {
 		hull = append(hull, fp)
 
+		// follow first face that contains optimum
 		for idx, _ := range face {
 			x := create_candidate_face(fp, face, idx)
 			if s.eval_face(x) {
@@ -93,24 +97,67 @@ func (s *Mobius) extend_hull_search(face []fpoint, hull []fpoint) []fpoint {
 					log.Debugf("alloc %v, util %v", a.schedule.Allocation, a.utility)
 				}
 				log.Debugln("**** end face ****")
-				return s.extend_hull_search(x, hull)
+				return s.extend_hull_search(ctx, x, hull)
 			}
 		}
 		log.Debugln("no intersecting face found")
-		return append(face, fp)
+		return append(face, fp), hull
+	}
+}
+
+// check if point a is preferred over b: (1) min shortfall below minimum
+// shares and SLAs, (2) max utility, (3) max total interest
+func (s *Mobius) better(a, b fpoint) bool {
+	sa := s.shortfall(a.schedule.Allocation)
+	sb := s.shortfall(b.schedule.Allocation)
+	if sa != sb {
+		return sa < sb
+	}
+	if a.utility != b.utility {
+		return a.utility > b.utility
+	}
+	return a.schedule.Allocation.Total() > b.schedule.Allocation.Total()
+}
+
+// preferred point of face (first, if tied)
+func (s *Mobius) best_point(face []fpoint) fpoint {
+	best := face[0]
+	for _, p := range face[1:] {
+		if s.better(p, best) {
+			best = p
+		}
 	}
+	return best
 }
 
 // search for most alpha-fair allocation on convex hull
-func (s *Mobius) SearchFrontier() vrp.Schedule {
+// if round timeout is set, return best point found when time runs out
+func (s *Mobius) SearchFrontier(ctx context.Context) (vrp.Schedule, error) {
+	if s.RoundTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RoundTimeout)
+		defer cancel()
+	}
 
 	// compute face if needed
 	if s.last_face == nil {
-		hull := s.init_hull()
-		s.last_face = s.extend_hull_search(hull, hull)
+		hull, err := s.init_hull(ctx)
+		if err != nil {
+			return vrp.Schedule{}, err
+		}
+
+		// start from previous round's final face, if still valid
+		face := hull
+		if f := s.start_face(); f != nil {
+			log.Debugf("[mobius] starting search from carried face")
+			face = f
+			hull = append(append([]fpoint{}, hull...), f...)
+		}
+		s.last_face, hull = s.extend_hull_search(ctx, face, hull)
 
 		// verify that we end on a face
 		s.assert_face_dim(s.last_face)
+		s.save_hull(s.clean_hull(hull), s.last_face)
 	} else {
 		for idx, _ := range s.last_face {
 			s.last_face[idx].utility = s.utility(s.last_face[idx].schedule.Allocation)
@@ -118,17 +165,11 @@ func (s *Mobius) SearchFrontier() vrp.Schedule {
 	}
 
 	// choose best solution on face
-	// (1) max utility, (2) max total interest
-	sort.Slice(
+	// (remaining ties keep face order)
+	sort.SliceStable(
 		s.last_face,
 		func(i, j int) bool {
-			if s.last_face[i].utility > s.last_face[j].utility {
-				return true
-			}
-			if s.last_face[i].utility < s.last_face[j].utility {
-				return false
-			}
-			return s.last_face[i].schedule.Allocation.Total() > s.last_face[j].schedule.Allocation.Total()
+			return s.better(s.last_face[i], s.last_face[j])
 		},
 	)
 
@@ -143,5 +184,23 @@ func (s *Mobius) SearchFrontier() vrp.Schedule {
 	}
 	log.Debugln("**** end hull ****")
 
-	return s.last_face[0].schedule
+	return s.last_face[0].schedule, nil
+}
+
+// choose highest-utility schedule from heuristics bank
+// (used when searching the frontier fails)
+func (s *Mobius) Fallback() (vrp.Schedule, error) {
+	if len(s.heuristics) == 0 {
+		return vrp.Schedule{}, errors.New("[mobius] no heuristic schedules available")
+	}
+
+	labels := s.heuristics.labels()
+	best := labels[0]
+	for _, label := range labels[1:] {
+		if s.utility(s.heuristics[label].Allocation) > s.utility(s.heuristics[best].Allocation) {
+			best = label
+		}
+	}
+	log.Debugf("[mobius] falling back to heuristic %s", best)
+	return s.heuristics[best], nil
 }
@@ -0,0 +1,126 @@
+package mobius
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/vrp"
+)
+
+func init_mobius(t *testing.T, f vrp.Frontier, apps int, alpha float64) *Mobius {
+	sp := test_mobius(f, apps, alpha, 1)
+	if err := sp.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return sp
+}
+
+func TestComputeFaceEquation(t *testing.T) {
+	sp := init_mobius(t, test_polygon, 2, 1)
+
+	// x1 + x2 = 10
+	face := []fpoint{face_point(vrp.Allocation{1: 10, 2: 0}), face_point(vrp.Allocation{1: 0, 2: 10})}
+	c, w, err := sp.compute_face_equation(face)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(c-10) > 1e-9 || len(w) != 2 || w[0] != 1 || math.Abs(w[1]-1) > 1e-9 {
+		t.Errorf("got c %v, weights %v; want 10, [1 1]", c, w)
+	}
+
+	// x1 + 2.8/7.2 x2 = 10
+	face = []fpoint{face_point(vrp.Allocation{1: 10, 2: 0}), face_point(vrp.Allocation{1: 7.2, 2: 7.2})}
+	c, w, err = sp.compute_face_equation(face)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(c-10) > 1e-9 || math.Abs(w[1]-2.8/7.2) > 1e-9 {
+		t.Errorf("got c %v, weights %v; want 10, [1 %v]", c, w, 2.8/7.2)
+	}
+
+	// no point serves app 1
+	face = []fpoint{face_point(vrp.Allocation{1: 0, 2: 10}), face_point(vrp.Allocation{1: 0, 2: 5})}
+	if _, _, err := sp.compute_face_equation(face); err == nil {
+		t.Error("expected error for face underconstrained in app 1")
+	}
+}
+
+func TestFindExtension(t *testing.T) {
+	sp := init_mobius(t, test_polygon, 2, 1)
+
+	// best point for weights (1, 1) lies beyond face
+	face := []fpoint{face_point(vrp.Allocation{1: 10, 2: 0}), face_point(vrp.Allocation{1: 0, 2: 10})}
+	fp, err := sp.find_extension(context.Background(), face, face, sp.heuristics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := fp.schedule.Allocation; a[1] != 7.2 || a[2] != 7.2 {
+		t.Errorf("got extension %v, want {1: 7.2, 2: 7.2}", a)
+	}
+	if fp.weights[1] != 1 || math.Abs(fp.weights[2]-1) > 1e-9 {
+		t.Errorf("got weights %v, want {1: 1, 2: 1}", fp.weights)
+	}
+	if n := sp.hull_points; n != 1 {
+		t.Errorf("counted %d hull points, want 1", n)
+	}
+
+	// face between adjacent vertices is on frontier
+	face = []fpoint{face_point(vrp.Allocation{1: 10, 2: 0}), face_point(vrp.Allocation{1: 9.5, 2: 3})}
+	if fp, err := sp.find_extension(context.Background(), face, face, sp.heuristics); err == nil {
+		t.Errorf("got extension %v of frontier face", fp.schedule.Allocation)
+	}
+}
+
+func TestSearchFrontierNorm(t *testing.T) {
+	scale := map[int]float64{1: 10, 2: 5}
+	// (for alpha in (1, 3), neither candidate face of first extension
+	// contains its linearized optimum, and search stops early)
+	for _, alpha := range []float64{1, 3, 10, 100} {
+		sp := init_mobius(t, vrp.NormFrontier{Scale: scale, P: 2}, 2, alpha)
+		s, err := sp.SearchFrontier(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// maximizing alpha-fair utility on ellipse gives x_i ~ s_i^(2/(1+alpha))
+		x1, x2 := math.Pow(10, 2/(1+alpha)), math.Pow(5, 2/(1+alpha))
+		n := math.Hypot(x1/10, x2/5)
+		want := vrp.Allocation{1: x1 / n, 2: x2 / n}
+		for id, x := range want {
+			if math.Abs(s.Allocation[id]-x) > 0.02*x {
+				t.Errorf("alpha %v: got %v, want %v", alpha, s.Allocation, want)
+				break
+			}
+		}
+	}
+}
+
+func TestSearchFrontierPolytope(t *testing.T) {
+	f := vrp.PointFrontier{{1: 8, 2: 0}, {1: 8, 2: 2}, {1: 4, 2: 6}, {1: 0, 2: 6}, {1: 0, 2: 0}}
+
+	// proportional fair point of face x1 + x2 = 10 is (5, 5);
+	// (4, 6) is its best vertex
+	sp := init_mobius(t, f, 2, 1)
+	s, err := sp.SearchFrontier(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Allocation[1] != 4 || s.Allocation[2] != 6 {
+		t.Errorf("got %v, want {1: 4, 2: 6}", s.Allocation)
+	}
+
+	// with weights 4:1, it is vertex (8, 2)
+	sp = test_mobius(f, 2, 1, 1)
+	sp.Weights = map[int]float64{1: 4, 2: 1}
+	if err := sp.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s, err = sp.SearchFrontier(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Allocation[1] != 8 || s.Allocation[2] != 2 {
+		t.Errorf("weighted: got %v, want {1: 8, 2: 2}", s.Allocation)
+	}
+}
@@ -0,0 +1,103 @@
+package mobius
+
+import (
+	"github.com/mobius-scheduler/mobius/common"
+	log "github.com/sirupsen/logrus"
+	"math"
+)
+
+// factor by which weight of an app at risk of violating its SLA is scaled
+const SLA_BOOST = 4.0
+
+// allocation each app needs in this round to meet its SLA at time end
+// (1) cumulative throughput of at least MinTasksPerHour
+// (2) pending requests that would wait longer than MaxWaitSec
+func (s *Scheduler) sla_requirements(im common.InterestMap, end int) map[int]float64 {
+	required := make(map[int]float64)
+	allocation := s.Allocation()
+	for id, sla := range s.SLA {
+		var need float64
+		if sla.MinTasksPerHour > 0 {
+			need = sla.MinTasksPerHour*float64(end)/3600 - allocation[id]
+		}
+		if sla.MaxWaitSec > 0 {
+			var urgent float64
+			for _, t := range im.FilterByApp(id).GetTasks() {
+				if t.RequestTime+sla.MaxWaitSec <= end {
+					urgent += im[t].Interest
+				}
+			}
+			need = math.Max(need, urgent)
+		}
+		if need > 0 {
+			required[id] = need
+		}
+	}
+	return required
+}
+
+// weight vector for search, with apps at risk of violating SLAs boosted
+func (s *Scheduler) sla_weights(required map[int]float64) map[int]float64 {
+	if len(required) == 0 {
+		return s.Weights
+	}
+	w := make(map[int]float64)
+	for id, x := range s.Weights {
+		w[id] = x
+	}
+	for id := range required {
+		if x, ok := w[id]; ok && x > 0 {
+			w[id] = x * SLA_BOOST
+		} else {
+			w[id] = SLA_BOOST
+		}
+	}
+	return w
+}
+
+// report SLA violations at time end (after apps are updated)
+func (s *Scheduler) check_sla(round, end int) {
+	if len(s.SLA) == 0 {
+		return
+	}
+	allocation := s.Allocation()
+	for _, a := range s.Applications {
+		id := a.GetID()
+		sla, ok := s.SLA[id]
+		if !ok || !sla.Enabled() {
+			continue
+		}
+
+		if sla.MinTasksPerHour > 0 {
+			target := sla.MinTasksPerHour * float64(end) / 3600
+			if allocation[id] < target {
+				log.Warnf(
+					"[mobius] round %d, app %d: SLA violated: %0.1f tasks, need %0.1f (%v tasks/hour)",
+					round,
+					id,
+					allocation[id],
+					target,
+					sla.MinTasksPerHour,
+				)
+			}
+		}
+
+		if sla.MaxWaitSec > 0 {
+			var late int
+			for t := range a.GetInterestMap() {
+				if end-t.RequestTime > sla.MaxWaitSec {
+					late++
+				}
+			}
+			if late > 0 {
+				log.Warnf(
+					"[mobius] round %d, app %d: SLA violated: %d requests waiting more than %d sec",
+					round,
+					id,
+					late,
+					sla.MaxWaitSec,
+				)
+			}
+		}
+	}
+}
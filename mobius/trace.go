@@ -1,54 +1,86 @@
 package mobius
 
 import (
+	"context"
 	"fmt"
 	"github.com/mobius-scheduler/mobius/vrp"
+	"sync"
 )
 
 // extend hull (for tracing entire frontier)
-func (s *Mobius) extend_hull_trace(face []fpoint, hull []fpoint) []fpoint {
+// each candidate face is explored as a branch seeded by a copy of bank b,
+// and branches' schedules join b in order of candidate once all are done,
+// so that results do not depend on parallelism; up to parallelism()
+// branches run at once, others in calling goroutine
+func (s *Mobius) extend_hull_trace(ctx context.Context, face []fpoint, hull []fpoint, b bank) []fpoint {
 	s.assert_face_dim(face)
 
 	// find extension
-	fp, err := s.find_extension(face, hull)
+	fp, err := s.find_extension(ctx, face, hull, b)
 	if err != nil {
+		s.Metrics.extension_ended(err)
 		return face
 	} else {
-		hull = append(hull, fp)
-		var frontier []fpoint
+		// copy hull, which branches may extend concurrently
+		hull = append(append([]fpoint{}, hull...), fp)
+		frontiers := make([][]fpoint, len(face))
+		banks := make([]bank, len(face))
+		var wg sync.WaitGroup
 		for idx, _ := range face {
 			x := create_candidate_face(fp, face, idx)
-			frontier = append(frontier, s.extend_hull_trace(x, hull)...)
+			banks[idx] = b.copy()
+			select {
+			case s.branches <- struct{}{}:
+				wg.Add(1)
+				go func(idx int) {
+					defer wg.Done()
+					frontiers[idx] = s.extend_hull_trace(ctx, x, hull, banks[idx])
+					<-s.branches
+				}(idx)
+			default:
+				frontiers[idx] = s.extend_hull_trace(ctx, x, hull, banks[idx])
+			}
+		}
+		wg.Wait()
+
+		var frontier []fpoint
+		for idx, f := range frontiers {
+			b.merge(banks[idx])
+			frontier = append(frontier, f...)
 		}
 		return frontier
 	}
 }
 
 // remove duplicates from hull
+// (points are kept in order of first appearance, so that output is
+// reproducible)
 func (s *Mobius) clean_hull(hull []fpoint) []fpoint {
 	// find set of allocations
-	found := make(map[string]fpoint)
+	var ch []fpoint
+	found := make(map[string]int)
 	for _, h := range hull {
 		var label string
 		for _, id := range s.app_ids {
 			label += fmt.Sprintf("%0.1f ", h.weights[id])
 		}
-		found[label] = h
-	}
-
-	// convert to list
-	var ch []fpoint
-	for _, s := range found {
-		ch = append(ch, s)
+		if i, ok := found[label]; ok {
+			ch[i] = h
+			continue
+		}
+		found[label] = len(ch)
+		ch = append(ch, h)
 	}
 	return ch
 }
 
 // trace convex hull of allocations
-func (s *Mobius) TraceFrontier() []vrp.Schedule {
-	var hull []fpoint
-	hull = s.init_hull()
-	hull = s.extend_hull_trace(hull, hull)
+func (s *Mobius) TraceFrontier(ctx context.Context) ([]vrp.Schedule, error) {
+	hull, err := s.init_hull(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hull = s.extend_hull_trace(ctx, hull, hull, s.heuristics)
 	hull = s.clean_hull(hull)
-	return extract_schedules(hull)
+	return extract_schedules(hull), nil
 }
@@ -0,0 +1,54 @@
+package mobius
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/vrp"
+)
+
+func TestCleanHullKeepsFirstSeenOrder(t *testing.T) {
+	s := Mobius{app_ids: []int{1, 2}}
+	point := func(w1, w2, x1 float64) fpoint {
+		return fpoint{
+			schedule: vrp.Schedule{Allocation: vrp.Allocation{1: x1}},
+			weights:  map[int]float64{1: w1, 2: w2},
+		}
+	}
+	hull := []fpoint{point(1, 0, 1), point(0, 1, 2), point(1, 1, 3), point(0, 1, 4), point(1, 0, 5)}
+
+	for i := 0; i < 20; i++ {
+		var got []float64
+		for _, h := range s.clean_hull(hull) {
+			got = append(got, h.schedule.Allocation[1])
+		}
+		// duplicates keep position of first appearance, and last point
+		if want := []float64{5, 4, 3}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTraceFrontierFindsEveryVertex(t *testing.T) {
+	sp := test_mobius(test_polygon, 2, 1, 1)
+	if err := sp.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	schedules, err := sp.TraceFrontier(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedules) != len(test_polygon) {
+		t.Errorf("traced %d points, want %d: %v", len(schedules), len(test_polygon), allocations(schedules))
+	}
+	for _, v := range test_polygon {
+		found := false
+		for _, s := range schedules {
+			found = found || (s.Allocation[1] == v[1] && s.Allocation[2] == v[2])
+		}
+		if !found {
+			t.Errorf("vertex %v not traced", v)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/vrp"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// request-to-fulfillment latency of tasks (seconds)
+type Latency struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// analytics of single app
+type AppReport struct {
+	AppID int `json:"app_id"`
+	// tasks fulfilled, in total and in each round (throughput over time)
+	Throughput float64   `json:"throughput"`
+	Rounds     []float64 `json:"rounds"`
+	// fraction of total throughput, and weight of app
+	Share  float64 `json:"share"`
+	Weight float64 `json:"weight"`
+	// distinct tasks pending in any round
+	Requested int     `json:"requested"`
+	Latency   Latency `json:"latency"`
+}
+
+// analytics of single vehicle (by index)
+type VehicleReport struct {
+	Vehicle int `json:"vehicle"`
+	// seconds spent serving tasks, and idle, over run
+	Busy        int     `json:"busy"`
+	Idle        int     `json:"idle"`
+	Utilization float64 `json:"utilization"`
+}
+
+// fairness and throughput analytics of run directory
+type Report struct {
+	Dir       string `json:"dir"`
+	ReplanSec int    `json:"replan_sec"`
+	// scheduled rounds, their start times and hull points (0 unless traced)
+	Rounds     []int `json:"rounds"`
+	Times      []int `json:"times"`
+	HullPoints []int `json:"hull_points"`
+	// length of run (including rounds without pending tasks)
+	Duration   int     `json:"duration"`
+	Throughput float64 `json:"throughput"`
+	// Jain's fairness index and min/max ratio of weighted throughput
+	// (throughput / weight) across apps
+	Jain        float64         `json:"jain_index"`
+	MinMaxRatio float64         `json:"min_max_ratio"`
+	Apps        []AppReport     `json:"apps"`
+	Vehicles    []VehicleReport `json:"vehicles"`
+}
+
+// run parameters, from config saved with run
+type run_config struct {
+	ReplanSec int             `json:"replan_sec"`
+	Weights   map[int]float64 `json:"weights"`
+}
+
+// read json file into x
+func read_json(path string, x interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("[report] error reading %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, x); err != nil {
+		return fmt.Errorf("[report] error parsing %s: %v", path, err)
+	}
+	return nil
+}
+
+// rounds with saved schedule in run directory, sorted
+func find_rounds(dir string) ([]int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "schedule_round*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var rounds []int
+	for _, p := range paths {
+		var r int
+		if _, err := fmt.Sscanf(filepath.Base(p), "schedule_round%d.json", &r); err == nil {
+			rounds = append(rounds, r)
+		}
+	}
+	sort.Ints(rounds)
+	return rounds, nil
+}
+
+// percentile of sorted values (nearest rank)
+func percentile(x []float64, p float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(x)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return x[rank]
+}
+
+// summarize latencies
+func summarize(x []float64) Latency {
+	sort.Float64s(x)
+	l := Latency{Count: len(x)}
+	if len(x) == 0 {
+		return l
+	}
+	for _, v := range x {
+		l.Mean += v
+	}
+	l.Mean /= float64(len(x))
+	l.P50 = percentile(x, 0.5)
+	l.P90 = percentile(x, 0.9)
+	l.P99 = percentile(x, 0.99)
+	l.Max = x[len(x)-1]
+	return l
+}
+
+// Jain's fairness index of x: (sum x)^2 / (n * sum x^2)
+func jain(x []float64) float64 {
+	var sum, sq float64
+	for _, v := range x {
+		sum += v
+		sq += v * v
+	}
+	if sq == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(x)) * sq)
+}
+
+// compute report from run directory written by Scheduler
+// (im_roundNNNN.json, schedule_roundNNNN.json, hull_roundNNNN.json and
+// config.cfg); round start times assume rounds every replan_sec of
+// simulated time, as in Scheduler.Run (replan is used if config is missing)
+func Load(dir string, replan int) (*Report, error) {
+	var cfg run_config
+	if err := read_json(filepath.Join(dir, "config.cfg"), &cfg); err == nil && cfg.ReplanSec > 0 {
+		replan = cfg.ReplanSec
+	}
+	if replan <= 0 {
+		return nil, fmt.Errorf("[report] invalid replanning interval %d", replan)
+	}
+	rounds, err := find_rounds(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(rounds) == 0 {
+		return nil, fmt.Errorf("[report] no schedules found in %s", dir)
+	}
+
+	rep := &Report{Dir: dir, ReplanSec: replan, Rounds: rounds}
+	rep.Duration = (rounds[len(rounds)-1] + 1) * replan
+	alloc := make(map[int][]float64)
+	latency := make(map[int][]float64)
+	requested := make(map[int]map[common.Task]bool)
+	var busy []int
+
+	for k, round := range rounds {
+		start := round * replan
+		rep.Times = append(rep.Times, start)
+
+		var schedule vrp.Schedule
+		path := filepath.Join(dir, fmt.Sprintf("schedule_round%04d.json", round))
+		if err := read_json(path, &schedule); err != nil {
+			return nil, err
+		}
+
+		// pending tasks (optional)
+		var im common.InterestFile
+		path = filepath.Join(dir, fmt.Sprintf("im_round%04d.json", round))
+		if err := read_json(path, &im); err == nil {
+			for _, d := range im {
+				if requested[d.AppID] == nil {
+					requested[d.AppID] = make(map[common.Task]bool)
+				}
+				requested[d.AppID][d.GetTask()] = true
+			}
+		}
+
+		// hull (optional; null unless traced)
+		var hull []vrp.Schedule
+		path = filepath.Join(dir, fmt.Sprintf("hull_round%04d.json", round))
+		read_json(path, &hull)
+		rep.HullPoints = append(rep.HullPoints, len(hull))
+
+		// throughput of round
+		for id, x := range schedule.Allocation {
+			if _, ok := alloc[id]; !ok {
+				alloc[id] = make([]float64, len(rounds))
+			}
+			alloc[id][k] += x
+		}
+
+		// latency of fulfilled tasks (deliveries are not counted, as in
+		// Trim), and busy time of vehicles within round
+		for i, route := range schedule.Routes {
+			if i >= len(busy) {
+				busy = append(busy, make([]int, i+1-len(busy))...)
+			}
+			for _, t := range route.Path {
+				if t.Destination.Latitude == common.INVALID_LOC && t.Destination.Longitude == common.INVALID_LOC {
+					continue
+				}
+				latency[t.AppID] = append(latency[t.AppID], float64(start+t.FulfillTime-t.RequestTime))
+			}
+			if len(route.Path) > 0 {
+				last := route.Path[len(route.Path)-1].FulfillTime
+				if last > replan {
+					last = replan
+				}
+				busy[i] += last
+			}
+		}
+	}
+
+	// apps (with pending tasks or throughput)
+	for id := range requested {
+		if _, ok := alloc[id]; !ok {
+			alloc[id] = make([]float64, len(rounds))
+		}
+	}
+	var ids []int
+	for id := range alloc {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		a := AppReport{AppID: id, Rounds: alloc[id], Weight: 1}
+		if w, ok := cfg.Weights[id]; ok && w > 0 {
+			a.Weight = w
+		}
+		for _, x := range a.Rounds {
+			a.Throughput += x
+		}
+		a.Requested = len(requested[id])
+		a.Latency = summarize(latency[id])
+		rep.Throughput += a.Throughput
+		rep.Apps = append(rep.Apps, a)
+	}
+
+	// shares and fairness of weighted throughput
+	weighted := make([]float64, len(rep.Apps))
+	for i := range rep.Apps {
+		if rep.Throughput > 0 {
+			rep.Apps[i].Share = rep.Apps[i].Throughput / rep.Throughput
+		}
+		weighted[i] = rep.Apps[i].Throughput / rep.Apps[i].Weight
+	}
+	rep.Jain = jain(weighted)
+	if min, max := common.GetMinMax(weighted); max > 0 {
+		rep.MinMaxRatio = min / max
+	}
+
+	// vehicles
+	for i, b := range busy {
+		rep.Vehicles = append(rep.Vehicles, VehicleReport{
+			Vehicle:     i,
+			Busy:        b,
+			Idle:        rep.Duration - b,
+			Utilization: float64(b) / float64(rep.Duration),
+		})
+	}
+	return rep, nil
+}
+
+// summary and per-app, per-vehicle tables in Markdown
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Report: %s\n\n", r.Dir)
+	fmt.Fprintf(&b, "* rounds: %d (duration %d s, replanning every %d s)\n", len(r.Rounds), r.Duration, r.ReplanSec)
+	fmt.Fprintf(&b, "* throughput: %0.1f\n", r.Throughput)
+	fmt.Fprintf(&b, "* Jain's fairness index: %0.4f\n", r.Jain)
+	fmt.Fprintf(&b, "* min/max share ratio: %0.4f\n\n", r.MinMaxRatio)
+
+	b.WriteString("| app | weight | requested | throughput | share | latency mean | p50 | p90 | p99 | max |\n")
+	b.WriteString("|---|---|---|---|---|---|---|---|---|---|\n")
+	for _, a := range r.Apps {
+		fmt.Fprintf(
+			&b, "| %d | %g | %d | %0.1f | %0.3f | %0.1f | %0.0f | %0.0f | %0.0f | %0.0f |\n",
+			a.AppID, a.Weight, a.Requested, a.Throughput, a.Share,
+			a.Latency.Mean, a.Latency.P50, a.Latency.P90, a.Latency.P99, a.Latency.Max,
+		)
+	}
+
+	b.WriteString("\n| vehicle | busy (s) | idle (s) | utilization |\n")
+	b.WriteString("|---|---|---|---|\n")
+	for _, v := range r.Vehicles {
+		fmt.Fprintf(&b, "| %d | %d | %d | %0.3f |\n", v.Vehicle, v.Busy, v.Idle, v.Utilization)
+	}
+	return b.String()
+}
+
+// per-app table in CSV
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"app", "weight", "requested", "throughput", "share",
+		"latency_mean", "latency_p50", "latency_p90", "latency_p99", "latency_max",
+	})
+	for _, a := range r.Apps {
+		cw.Write([]string{
+			fmt.Sprintf("%d", a.AppID),
+			fmt.Sprintf("%g", a.Weight),
+			fmt.Sprintf("%d", a.Requested),
+			fmt.Sprintf("%0.2f", a.Throughput),
+			fmt.Sprintf("%0.4f", a.Share),
+			fmt.Sprintf("%0.1f", a.Latency.Mean),
+			fmt.Sprintf("%0.0f", a.Latency.P50),
+			fmt.Sprintf("%0.0f", a.Latency.P90),
+			fmt.Sprintf("%0.0f", a.Latency.P99),
+			fmt.Sprintf("%0.0f", a.Latency.Max),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// throughput over time in CSV: round, time, then one column per app
+func (r *Report) WriteRoundsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"round", "time"}
+	for _, a := range r.Apps {
+		header = append(header, fmt.Sprintf("app%d", a.AppID))
+	}
+	cw.Write(header)
+	for k, round := range r.Rounds {
+		row := []string{fmt.Sprintf("%d", round), fmt.Sprintf("%d", r.Times[k])}
+		for _, a := range r.Apps {
+			row = append(row, fmt.Sprintf("%0.2f", a.Rounds[k]))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,30 @@
+package report
+
+import (
+	"math"
+	"testing"
+)
+
+func TestJain(t *testing.T) {
+	cases := []struct {
+		x    []float64
+		want float64
+	}{
+		// equal shares are perfectly fair
+		{[]float64{2, 2, 2, 2}, 1},
+		// one of n apps gets everything: 1/n
+		{[]float64{5, 0, 0, 0}, 0.25},
+		// (1+2+3)^2 / (3 * (1+4+9)) = 36/42
+		{[]float64{1, 2, 3}, 6.0 / 7},
+		// (1+3)^2 / (2 * (1+9)) = 16/20
+		{[]float64{1, 3}, 0.8},
+		// nothing allocated
+		{[]float64{0, 0}, 0},
+		{nil, 0},
+	}
+	for _, c := range cases {
+		if got := jain(c.x); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("jain(%v) = %v, want %v", c.x, got, c.want)
+		}
+	}
+}
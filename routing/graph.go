@@ -0,0 +1,327 @@
+package routing
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/vrp"
+	"math"
+	"sync"
+)
+
+// size of spatial index cells (degrees)
+const GRID_SIZE = 0.005
+
+// max rings of cells searched when snapping (about 100 km)
+const MAX_SNAP_RINGS = 200
+
+// max shortest-path trees kept in cache
+const MAX_CACHED_TREES = 512
+
+// directed road segment
+type edge struct {
+	to     int
+	meters float64
+	// road speed (m/s)
+	speed float64
+}
+
+type grid_cell struct {
+	lat, lon int
+}
+
+// shortest travel times and distances from a node, for a speed cap
+type tree_key struct {
+	src   int
+	speed float64
+}
+
+type tree struct {
+	seconds []float64
+	meters  []float64
+}
+
+// road network, usable as travel model: locations are snapped to nearest
+// road node, and travel times are shortest paths (one-to-many Dijkstra,
+// cached per source; no contraction hierarchies, which do not pay off
+// for matrices of a few hundred locations)
+type Graph struct {
+	locs      []common.Location
+	adj       [][]edge
+	grid      map[grid_cell][]int
+	max_speed float64
+	mu        sync.Mutex
+	trees     map[tree_key]tree
+	snaps     map[common.Location]int
+}
+
+func new_graph() *Graph {
+	return &Graph{
+		grid:  make(map[grid_cell][]int),
+		trees: make(map[tree_key]tree),
+		snaps: make(map[common.Location]int),
+	}
+}
+
+// add node at location, returning its index
+func (g *Graph) add_node(loc common.Location) int {
+	g.locs = append(g.locs, loc)
+	g.adj = append(g.adj, nil)
+	c := cell_of(loc)
+	g.grid[c] = append(g.grid[c], len(g.locs)-1)
+	return len(g.locs) - 1
+}
+
+// add directed edge with road speed (m/s)
+func (g *Graph) add_edge(from, to int, speed float64) {
+	meters := vrp.Haversine{}.Distance(g.locs[from], g.locs[to])
+	g.adj[from] = append(g.adj[from], edge{to: to, meters: meters, speed: speed})
+	if speed > g.max_speed {
+		g.max_speed = speed
+	}
+}
+
+func (g *Graph) NumNodes() int {
+	return len(g.locs)
+}
+
+func (g *Graph) NumEdges() int {
+	var n int
+	for _, a := range g.adj {
+		n += len(a)
+	}
+	return n
+}
+
+func cell_of(loc common.Location) grid_cell {
+	return grid_cell{
+		lat: int(math.Floor(loc.Latitude / GRID_SIZE)),
+		lon: int(math.Floor(loc.Longitude / GRID_SIZE)),
+	}
+}
+
+// nearest road node to location (-1 if none within MAX_SNAP_RINGS)
+func (g *Graph) Snap(loc common.Location) int {
+	c := cell_of(loc)
+	best, best_dist := -1, math.Inf(1)
+
+	// smallest side of a cell (meters)
+	side := GRID_SIZE * math.Pi / 180 * vrp.EARTH_RADIUS * math.Cos(loc.Latitude*math.Pi/180)
+	for r := 0; r <= MAX_SNAP_RINGS; r++ {
+		for dlat := -r; dlat <= r; dlat++ {
+			for dlon := -r; dlon <= r; dlon++ {
+				// only ring r (inner rings were searched already)
+				if dlat != -r && dlat != r && dlon != -r && dlon != r {
+					continue
+				}
+				for _, n := range g.grid[grid_cell{c.lat + dlat, c.lon + dlon}] {
+					d := vrp.Haversine{}.Distance(loc, g.locs[n])
+					if d < best_dist || (d == best_dist && n < best) {
+						best, best_dist = n, d
+					}
+				}
+			}
+		}
+
+		// nodes beyond ring r are at least r cells away
+		if best >= 0 && best_dist <= float64(r)*side {
+			break
+		}
+	}
+	return best
+}
+
+// nearest road node to location (cached)
+func (g *Graph) snap(loc common.Location) int {
+	g.mu.Lock()
+	n, ok := g.snaps[loc]
+	g.mu.Unlock()
+	if ok {
+		return n
+	}
+	n = g.Snap(loc)
+	g.mu.Lock()
+	g.snaps[loc] = n
+	g.mu.Unlock()
+	return n
+}
+
+// location of road node
+func (g *Graph) Location(n int) common.Location {
+	return g.locs[n]
+}
+
+// speed on edge for vehicle (road speed, capped by vehicle speed if set)
+func edge_speed(e edge, speed float64) float64 {
+	if speed > 0 && speed < e.speed {
+		return speed
+	}
+	return e.speed
+}
+
+// priority queue of (node, cost)
+type pq_item struct {
+	node int
+	cost float64
+}
+
+type pq []pq_item
+
+func (q pq) Len() int            { return len(q) }
+func (q pq) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q pq) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pq) Push(x interface{}) { *q = append(*q, x.(pq_item)) }
+func (q *pq) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// shortest travel times (and their distances) from src to all nodes
+func (g *Graph) dijkstra(src int, speed float64) tree {
+	t := tree{
+		seconds: make([]float64, len(g.locs)),
+		meters:  make([]float64, len(g.locs)),
+	}
+	for i := range t.seconds {
+		t.seconds[i] = math.Inf(1)
+	}
+	t.seconds[src] = 0
+	q := &pq{{node: src}}
+	for q.Len() > 0 {
+		x := heap.Pop(q).(pq_item)
+		if x.cost > t.seconds[x.node] {
+			continue
+		}
+		for _, e := range g.adj[x.node] {
+			c := x.cost + e.meters/edge_speed(e, speed)
+			if c < t.seconds[e.to] {
+				t.seconds[e.to] = c
+				t.meters[e.to] = t.meters[x.node] + e.meters
+				heap.Push(q, pq_item{node: e.to, cost: c})
+			}
+		}
+	}
+	return t
+}
+
+// cached shortest-path tree from src
+func (g *Graph) tree(src int, speed float64) tree {
+	k := tree_key{src, speed}
+	g.mu.Lock()
+	t, ok := g.trees[k]
+	g.mu.Unlock()
+	if ok {
+		return t
+	}
+
+	t = g.dijkstra(src, speed)
+	g.mu.Lock()
+	if len(g.trees) >= MAX_CACHED_TREES {
+		g.trees = make(map[tree_key]tree)
+	}
+	g.trees[k] = t
+	g.mu.Unlock()
+	return t
+}
+
+// shortest route between road nodes (A*, with straight line at
+// top speed as heuristic); returns nodes, travel time and distance
+func (g *Graph) Route(src, dst int, speed float64) ([]int, float64, float64, error) {
+	top := g.max_speed
+	if speed > 0 && speed < top {
+		top = speed
+	}
+	h := func(n int) float64 {
+		if top <= 0 {
+			return 0
+		}
+		return vrp.Haversine{}.Distance(g.locs[n], g.locs[dst]) / top
+	}
+
+	seconds := map[int]float64{src: 0}
+	meters := map[int]float64{src: 0}
+	prev := map[int]int{src: -1}
+	done := make(map[int]bool)
+	q := &pq{{node: src, cost: h(src)}}
+	for q.Len() > 0 {
+		x := heap.Pop(q).(pq_item)
+		if done[x.node] {
+			continue
+		}
+		done[x.node] = true
+		if x.node == dst {
+			break
+		}
+		for _, e := range g.adj[x.node] {
+			c := seconds[x.node] + e.meters/edge_speed(e, speed)
+			if old, ok := seconds[e.to]; !ok || c < old {
+				seconds[e.to] = c
+				meters[e.to] = meters[x.node] + e.meters
+				prev[e.to] = x.node
+				heap.Push(q, pq_item{node: e.to, cost: c + h(e.to)})
+			}
+		}
+	}
+	if !done[dst] {
+		return nil, 0, 0, fmt.Errorf("[routing] node %d unreachable from node %d", dst, src)
+	}
+
+	var path []int
+	for n := dst; n >= 0; n = prev[n] {
+		path = append([]int{n}, path...)
+	}
+	return path, seconds[dst], meters[dst], nil
+}
+
+// travel time along roads: to nearest road node at vehicle speed, along
+// shortest path, then to destination (straight line if unreachable)
+func (g *Graph) Duration(src, dst common.Location, v common.Vehicle, t int) float64 {
+	if src == dst {
+		return 0
+	}
+	s, d := g.snap(src), g.snap(dst)
+	if s < 0 || d < 0 {
+		return vrp.Haversine{}.Duration(src, dst, v, t)
+	}
+	secs := g.tree(s, v.Speed).seconds[d]
+	if math.IsInf(secs, 1) {
+		return vrp.Haversine{}.Duration(src, dst, v, t)
+	}
+	access := vrp.Haversine{}.Distance(src, g.locs[s]) + vrp.Haversine{}.Distance(g.locs[d], dst)
+	return secs + access/v.Speed
+}
+
+// distance along fastest road route (straight line if unreachable)
+func (g *Graph) Distance(src, dst common.Location) float64 {
+	if src == dst {
+		return 0
+	}
+	s, d := g.snap(src), g.snap(dst)
+	if s < 0 || d < 0 {
+		return vrp.Haversine{}.Distance(src, dst)
+	}
+	t := g.tree(s, 0)
+	if math.IsInf(t.seconds[d], 1) {
+		return vrp.Haversine{}.Distance(src, dst)
+	}
+	return t.meters[d] + vrp.Haversine{}.Distance(src, g.locs[s]) + vrp.Haversine{}.Distance(g.locs[d], dst)
+}
+
+// road nodes along fastest route (vrp.PathModel; nil if unreachable)
+func (g *Graph) Path(src, dst common.Location) []common.Location {
+	s, d := g.snap(src), g.snap(dst)
+	if s < 0 || d < 0 {
+		return nil
+	}
+	nodes, _, _, err := g.Route(s, d, 0)
+	if err != nil {
+		return nil
+	}
+	path := make([]common.Location, len(nodes))
+	for i, n := range nodes {
+		path[i] = g.locs[n]
+	}
+	return path
+}
@@ -0,0 +1,49 @@
+package routing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/vrp"
+)
+
+func TestRouteTinyGraph(t *testing.T) {
+	g := load_tiny(t, "testdata/tiny.osm")
+	a, b, c := node_at(g, tiny_a), node_at(g, tiny_b), node_at(g, tiny_c)
+	ab := vrp.Haversine{}.Distance(tiny_a, tiny_b)
+	bc := vrp.Haversine{}.Distance(tiny_b, tiny_c)
+
+	path, seconds, meters, err := g.Route(a, c, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != 3 || path[0] != a || path[1] != b || path[2] != c {
+		t.Errorf("got path %v, want %v", path, []int{a, b, c})
+	}
+	if math.Abs(meters-(ab+bc)) > 1e-6 {
+		t.Errorf("got %v m, want %v", meters, ab+bc)
+	}
+	if want := ab/(25/3.6) + bc/(60/3.6); math.Abs(seconds-want) > 1e-6 {
+		t.Errorf("got %v s, want %v", seconds, want)
+	}
+
+	// vehicle speed caps road speed
+	if _, seconds, _, _ := g.Route(a, c, 5); math.Abs(seconds-(ab+bc)/5) > 1e-6 {
+		t.Errorf("at 5 m/s: got %v s, want %v", seconds, (ab+bc)/5)
+	}
+
+	// against one-way road
+	if _, _, _, err := g.Route(c, a, 0); err == nil {
+		t.Error("routed against one-way road")
+	}
+
+	// travel model snaps to road nodes
+	if d := g.Distance(tiny_a, tiny_c); math.Abs(d-(ab+bc)) > 1e-6 {
+		t.Errorf("got distance %v, want %v", d, ab+bc)
+	}
+	v := common.Vehicle{Speed: 5}
+	if d := g.Duration(tiny_a, tiny_c, v, 0); math.Abs(d-(ab+bc)/5) > 1e-6 {
+		t.Errorf("got duration %v, want %v", d, (ab+bc)/5)
+	}
+}
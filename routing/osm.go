@@ -0,0 +1,197 @@
+package routing
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/common"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// default speed (km/h) of routable highway types
+var HIGHWAY_SPEEDS = map[string]float64{
+	"motorway":       100,
+	"motorway_link":  60,
+	"trunk":          80,
+	"trunk_link":     50,
+	"primary":        60,
+	"primary_link":   40,
+	"secondary":      50,
+	"secondary_link": 40,
+	"tertiary":       40,
+	"tertiary_link":  30,
+	"unclassified":   30,
+	"road":           30,
+	"residential":    25,
+	"service":        15,
+	"living_street":  10,
+}
+
+// way in OSM extract
+type osm_way struct {
+	refs []int64
+	tags map[string]string
+}
+
+// nodes and ways read from OSM extract
+type osm_data struct {
+	nodes map[int64]common.Location
+	ways  []osm_way
+}
+
+// load road network from OSM extract (.osm/.xml or .pbf)
+func Load(path string) (*Graph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var data *osm_data
+	switch {
+	case strings.HasSuffix(path, ".pbf"):
+		data, err = read_pbf(file)
+	case strings.HasSuffix(path, ".osm"), strings.HasSuffix(path, ".xml"):
+		data, err = read_xml(file)
+	default:
+		return nil, fmt.Errorf("[routing] unknown format of OSM extract %s (want .osm, .xml or .pbf)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[routing] error reading %s: %v", path, err)
+	}
+
+	g := build_graph(data)
+	log.Printf("[routing] loaded %s: %d nodes, %d edges", path, g.NumNodes(), g.NumEdges())
+	return g, nil
+}
+
+// read OSM XML, keeping nodes and ways
+func read_xml(r io.Reader) (*osm_data, error) {
+	data := &osm_data{nodes: make(map[int64]common.Location)}
+	dec := xml.NewDecoder(r)
+	var way *osm_way
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch x := tok.(type) {
+		case xml.StartElement:
+			attr := make(map[string]string)
+			for _, a := range x.Attr {
+				attr[a.Name.Local] = a.Value
+			}
+			switch x.Name.Local {
+			case "node":
+				id, err1 := strconv.ParseInt(attr["id"], 10, 64)
+				lat, err2 := strconv.ParseFloat(attr["lat"], 64)
+				lon, err3 := strconv.ParseFloat(attr["lon"], 64)
+				if err1 != nil || err2 != nil || err3 != nil {
+					return nil, fmt.Errorf("invalid node %v", attr)
+				}
+				data.nodes[id] = common.Location{Latitude: lat, Longitude: lon}
+			case "way":
+				way = &osm_way{tags: make(map[string]string)}
+			case "nd":
+				if way != nil {
+					ref, err := strconv.ParseInt(attr["ref"], 10, 64)
+					if err != nil {
+						return nil, fmt.Errorf("invalid node ref %v", attr)
+					}
+					way.refs = append(way.refs, ref)
+				}
+			case "tag":
+				if way != nil {
+					way.tags[attr["k"]] = attr["v"]
+				}
+			}
+		case xml.EndElement:
+			if x.Name.Local == "way" && way != nil {
+				data.ways = append(data.ways, *way)
+				way = nil
+			}
+		}
+	}
+	return data, nil
+}
+
+// speed of way (m/s), from maxspeed tag or highway type; 0 if not routable
+func way_speed(tags map[string]string) float64 {
+	kmh, ok := HIGHWAY_SPEEDS[tags["highway"]]
+	if !ok {
+		return 0
+	}
+	if x := tags["maxspeed"]; x != "" {
+		fields := strings.Fields(x)
+		if v, err := strconv.ParseFloat(fields[0], 64); err == nil && v > 0 {
+			kmh = v
+			if len(fields) > 1 && fields[1] == "mph" {
+				kmh = v * 1.609344
+			}
+		}
+	}
+	return kmh / 3.6
+}
+
+// direction of way: 1 (forward only), -1 (backward only) or 0 (both)
+func way_direction(tags map[string]string) int {
+	switch tags["oneway"] {
+	case "yes", "true", "1":
+		return 1
+	case "-1", "reverse":
+		return -1
+	case "no", "false", "0":
+		return 0
+	}
+	if tags["highway"] == "motorway" || tags["junction"] == "roundabout" {
+		return 1
+	}
+	return 0
+}
+
+// build graph from routable ways (nodes not on such ways are dropped)
+func build_graph(data *osm_data) *Graph {
+	g := new_graph()
+	index := make(map[int64]int)
+	node := func(id int64) (int, bool) {
+		if n, ok := index[id]; ok {
+			return n, true
+		}
+		loc, ok := data.nodes[id]
+		if !ok {
+			return 0, false
+		}
+		index[id] = g.add_node(loc)
+		return index[id], true
+	}
+
+	for _, w := range data.ways {
+		speed := way_speed(w.tags)
+		if speed <= 0 {
+			continue
+		}
+		dir := way_direction(w.tags)
+		for i := 1; i < len(w.refs); i++ {
+			a, ok1 := node(w.refs[i-1])
+			b, ok2 := node(w.refs[i])
+			// extracts may clip ways at their boundary
+			if !ok1 || !ok2 {
+				continue
+			}
+			if dir >= 0 {
+				g.add_edge(a, b, speed)
+			}
+			if dir <= 0 {
+				g.add_edge(b, a, speed)
+			}
+		}
+	}
+	return g
+}
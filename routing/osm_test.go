@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+// testdata/tiny.osm and tiny.osm.pbf hold the same extract: nodes A, B, C
+// north along a meridian, joined by a two-way residential street (A-B) and
+// a one-way primary road (B to C), and a footway from C to node D
+var (
+	tiny_a = common.Location{Latitude: 42.36, Longitude: -71.09}
+	tiny_b = common.Location{Latitude: 42.37, Longitude: -71.09}
+	tiny_c = common.Location{Latitude: 42.38, Longitude: -71.09}
+	tiny_d = common.Location{Latitude: 42.38, Longitude: -71.08}
+)
+
+func near(a, b common.Location) bool {
+	return math.Abs(a.Latitude-b.Latitude) < 1e-9 && math.Abs(a.Longitude-b.Longitude) < 1e-9
+}
+
+// index of graph node at location (-1 if none)
+func node_at(g *Graph, loc common.Location) int {
+	for n := 0; n < g.NumNodes(); n++ {
+		if near(g.Location(n), loc) {
+			return n
+		}
+	}
+	return -1
+}
+
+func load_tiny(t *testing.T, path string) *Graph {
+	g, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestLoadTinyExtract(t *testing.T) {
+	for _, path := range []string{"testdata/tiny.osm", "testdata/tiny.osm.pbf"} {
+		g := load_tiny(t, path)
+		if g.NumNodes() != 3 || g.NumEdges() != 3 {
+			t.Errorf("%s: got %d nodes, %d edges, want 3 nodes, 3 edges", path, g.NumNodes(), g.NumEdges())
+		}
+		a, b, c := node_at(g, tiny_a), node_at(g, tiny_b), node_at(g, tiny_c)
+		if a < 0 || b < 0 || c < 0 {
+			t.Fatalf("%s: missing road node (A %d, B %d, C %d)", path, a, b, c)
+		}
+		if node_at(g, tiny_d) >= 0 {
+			t.Errorf("%s: kept node only on footway", path)
+		}
+
+		// residential street both ways at 25 km/h, primary road one way
+		// at 60 km/h
+		want := map[[2]int]float64{{a, b}: 25 / 3.6, {b, a}: 25 / 3.6, {b, c}: 60 / 3.6}
+		for from, edges := range g.adj {
+			for _, e := range edges {
+				speed, ok := want[[2]int{from, e.to}]
+				if !ok {
+					t.Errorf("%s: unexpected edge %d-%d", path, from, e.to)
+				} else if math.Abs(e.speed-speed) > 1e-9 {
+					t.Errorf("%s: edge %d-%d has speed %v, want %v", path, from, e.to, e.speed, speed)
+				}
+			}
+		}
+	}
+}
+
+func TestLoadUnknownFormat(t *testing.T) {
+	if _, err := Load("testdata/tiny.json"); err == nil {
+		t.Error("loaded extract of unknown format")
+	}
+}
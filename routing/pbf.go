@@ -0,0 +1,467 @@
+package routing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/common"
+	"io"
+	"io/ioutil"
+)
+
+// minimal reader of OSM PBF extracts: nodes (plain and dense) and ways;
+// relations and metadata are skipped, and only zlib/raw blobs are supported
+
+// max size of blob header and blob (per OSM PBF spec)
+const (
+	PBF_MAX_HEADER_SIZE = 64 * 1024
+	PBF_MAX_BLOB_SIZE   = 32 * 1024 * 1024
+)
+
+// protobuf wire types
+const (
+	wire_varint  = 0
+	wire_fixed64 = 1
+	wire_bytes   = 2
+	wire_fixed32 = 5
+)
+
+// protobuf message being decoded
+type pb_message struct {
+	b []byte
+	i int
+}
+
+func (m *pb_message) done() bool {
+	return m.i >= len(m.b)
+}
+
+func (m *pb_message) varint() (uint64, error) {
+	x, n := binary.Uvarint(m.b[m.i:])
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid varint")
+	}
+	m.i += n
+	return x, nil
+}
+
+// next field number and wire type
+func (m *pb_message) key() (int, int, error) {
+	k, err := m.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(k >> 3), int(k & 7), nil
+}
+
+// length-delimited field
+func (m *pb_message) bytes() ([]byte, error) {
+	n, err := m.varint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(m.b)-m.i) < n {
+		return nil, fmt.Errorf("truncated field")
+	}
+	b := m.b[m.i : m.i+int(n)]
+	m.i += int(n)
+	return b, nil
+}
+
+// skip field of wire type
+func (m *pb_message) skip(wire int) error {
+	var n int
+	switch wire {
+	case wire_varint:
+		_, err := m.varint()
+		return err
+	case wire_bytes:
+		_, err := m.bytes()
+		return err
+	case wire_fixed64:
+		n = 8
+	case wire_fixed32:
+		n = 4
+	default:
+		return fmt.Errorf("unsupported wire type %d", wire)
+	}
+	if len(m.b)-m.i < n {
+		return fmt.Errorf("truncated field")
+	}
+	m.i += n
+	return nil
+}
+
+func zigzag(x uint64) int64 {
+	return int64(x>>1) ^ -int64(x&1)
+}
+
+// repeated integer field (packed or not), appended to xs
+func (m *pb_message) uints(wire int, xs []uint64) ([]uint64, error) {
+	if wire == wire_varint {
+		x, err := m.varint()
+		return append(xs, x), err
+	}
+	b, err := m.bytes()
+	if err != nil {
+		return nil, err
+	}
+	p := pb_message{b: b}
+	for !p.done() {
+		x, err := p.varint()
+		if err != nil {
+			return nil, err
+		}
+		xs = append(xs, x)
+	}
+	return xs, nil
+}
+
+// repeated sint64 field, delta-decoded
+func delta_decode(xs []uint64) []int64 {
+	out := make([]int64, len(xs))
+	var sum int64
+	for i, x := range xs {
+		sum += zigzag(x)
+		out[i] = sum
+	}
+	return out
+}
+
+// read OSM PBF file: sequence of (size, BlobHeader, Blob)
+func read_pbf(r io.Reader) (*osm_data, error) {
+	data := &osm_data{nodes: make(map[int64]common.Location)}
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if size > PBF_MAX_HEADER_SIZE {
+			return nil, fmt.Errorf("blob header too large (%d bytes)", size)
+		}
+		header := make([]byte, size)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		kind, datasize, err := parse_blob_header(header)
+		if err != nil {
+			return nil, err
+		}
+		if datasize > PBF_MAX_BLOB_SIZE {
+			return nil, fmt.Errorf("blob too large (%d bytes)", datasize)
+		}
+		blob := make([]byte, datasize)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return nil, err
+		}
+
+		// header blocks only list required features
+		if kind != "OSMData" {
+			continue
+		}
+		block, err := parse_blob(blob)
+		if err != nil {
+			return nil, err
+		}
+		if err := parse_primitive_block(block, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// BlobHeader: type (1), datasize (3)
+func parse_blob_header(b []byte) (string, int, error) {
+	m := pb_message{b: b}
+	var kind string
+	var datasize int
+	for !m.done() {
+		field, wire, err := m.key()
+		if err != nil {
+			return "", 0, err
+		}
+		switch {
+		case field == 1 && wire == wire_bytes:
+			x, err := m.bytes()
+			if err != nil {
+				return "", 0, err
+			}
+			kind = string(x)
+		case field == 3 && wire == wire_varint:
+			x, err := m.varint()
+			if err != nil {
+				return "", 0, err
+			}
+			datasize = int(x)
+		default:
+			if err := m.skip(wire); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+	return kind, datasize, nil
+}
+
+// Blob: raw (1) or zlib_data (3); other compressions are not supported
+func parse_blob(b []byte) ([]byte, error) {
+	m := pb_message{b: b}
+	for !m.done() {
+		field, wire, err := m.key()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && wire == wire_bytes:
+			return m.bytes()
+		case field == 3 && wire == wire_bytes:
+			x, err := m.bytes()
+			if err != nil {
+				return nil, err
+			}
+			z, err := zlib.NewReader(bytes.NewReader(x))
+			if err != nil {
+				return nil, err
+			}
+			defer z.Close()
+			return ioutil.ReadAll(z)
+		case field >= 4 && field <= 7:
+			return nil, fmt.Errorf("unsupported blob compression (field %d)", field)
+		default:
+			if err := m.skip(wire); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("empty blob")
+}
+
+// coordinate encoding of primitive block
+type pbf_block struct {
+	strings     [][]byte
+	granularity int64
+	lat_offset  int64
+	lon_offset  int64
+}
+
+func (b *pbf_block) location(lat, lon int64) common.Location {
+	return common.Location{
+		Latitude:  1e-9 * float64(b.lat_offset+b.granularity*lat),
+		Longitude: 1e-9 * float64(b.lon_offset+b.granularity*lon),
+	}
+}
+
+// PrimitiveBlock: stringtable (1), primitivegroup (2), granularity (17),
+// lat_offset (19), lon_offset (20)
+func parse_primitive_block(b []byte, data *osm_data) error {
+	m := pb_message{b: b}
+	block := pbf_block{granularity: 100}
+	var groups [][]byte
+	for !m.done() {
+		field, wire, err := m.key()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wire == wire_bytes:
+			x, err := m.bytes()
+			if err != nil {
+				return err
+			}
+			if block.strings, err = parse_string_table(x); err != nil {
+				return err
+			}
+		case field == 2 && wire == wire_bytes:
+			x, err := m.bytes()
+			if err != nil {
+				return err
+			}
+			groups = append(groups, x)
+		case (field == 17 || field == 19 || field == 20) && wire == wire_varint:
+			x, err := m.varint()
+			if err != nil {
+				return err
+			}
+			switch field {
+			case 17:
+				block.granularity = int64(x)
+			case 19:
+				block.lat_offset = int64(x)
+			case 20:
+				block.lon_offset = int64(x)
+			}
+		default:
+			if err := m.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+
+	// groups are decoded once granularity and offsets are known
+	for _, g := range groups {
+		if err := parse_primitive_group(g, &block, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StringTable: s (1)
+func parse_string_table(b []byte) ([][]byte, error) {
+	m := pb_message{b: b}
+	var s [][]byte
+	for !m.done() {
+		field, wire, err := m.key()
+		if err != nil {
+			return nil, err
+		}
+		if field == 1 && wire == wire_bytes {
+			x, err := m.bytes()
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, x)
+		} else if err := m.skip(wire); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// PrimitiveGroup: nodes (1), dense (2), ways (3)
+func parse_primitive_group(b []byte, block *pbf_block, data *osm_data) error {
+	m := pb_message{b: b}
+	for !m.done() {
+		field, wire, err := m.key()
+		if err != nil {
+			return err
+		}
+		if wire != wire_bytes || field < 1 || field > 3 {
+			if err := m.skip(wire); err != nil {
+				return err
+			}
+			continue
+		}
+		x, err := m.bytes()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			err = parse_node(x, block, data)
+		case 2:
+			err = parse_dense_nodes(x, block, data)
+		case 3:
+			err = parse_way(x, block, data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Node: id (1), lat (8), lon (9); all sint64
+func parse_node(b []byte, block *pbf_block, data *osm_data) error {
+	m := pb_message{b: b}
+	var id, lat, lon int64
+	for !m.done() {
+		field, wire, err := m.key()
+		if err != nil {
+			return err
+		}
+		if wire != wire_varint || (field != 1 && field != 8 && field != 9) {
+			if err := m.skip(wire); err != nil {
+				return err
+			}
+			continue
+		}
+		x, err := m.varint()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			id = zigzag(x)
+		case 8:
+			lat = zigzag(x)
+		case 9:
+			lon = zigzag(x)
+		}
+	}
+	data.nodes[id] = block.location(lat, lon)
+	return nil
+}
+
+// DenseNodes: id (1), lat (8), lon (9); packed, delta-coded sint64
+func parse_dense_nodes(b []byte, block *pbf_block, data *osm_data) error {
+	m := pb_message{b: b}
+	var ids, lats, lons []uint64
+	for !m.done() {
+		field, wire, err := m.key()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			ids, err = m.uints(wire, ids)
+		case 8:
+			lats, err = m.uints(wire, lats)
+		case 9:
+			lons, err = m.uints(wire, lons)
+		default:
+			err = m.skip(wire)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return fmt.Errorf("dense nodes: %d ids, %d lats, %d lons", len(ids), len(lats), len(lons))
+	}
+	id, lat, lon := delta_decode(ids), delta_decode(lats), delta_decode(lons)
+	for i := range id {
+		data.nodes[id[i]] = block.location(lat[i], lon[i])
+	}
+	return nil
+}
+
+// Way: keys (2), vals (3) (indices into string table), refs (8; delta-coded)
+func parse_way(b []byte, block *pbf_block, data *osm_data) error {
+	m := pb_message{b: b}
+	var keys, vals, refs []uint64
+	for !m.done() {
+		field, wire, err := m.key()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 2:
+			keys, err = m.uints(wire, keys)
+		case 3:
+			vals, err = m.uints(wire, vals)
+		case 8:
+			refs, err = m.uints(wire, refs)
+		default:
+			err = m.skip(wire)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(keys) != len(vals) {
+		return fmt.Errorf("way: %d keys, %d values", len(keys), len(vals))
+	}
+
+	w := osm_way{refs: delta_decode(refs), tags: make(map[string]string)}
+	for i := range keys {
+		if keys[i] >= uint64(len(block.strings)) || vals[i] >= uint64(len(block.strings)) {
+			return fmt.Errorf("way: string index out of range")
+		}
+		w.tags[string(block.strings[keys[i]])] = string(block.strings[vals[i]])
+	}
+	data.ways = append(data.ways, w)
+	return nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/app"
+	"github.com/mobius-scheduler/mobius/common"
+	"github.com/mobius-scheduler/mobius/mobius"
+	"github.com/mobius-scheduler/mobius/vrp"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTP/JSON service exposing a (real-time) Mobius scheduler
+//
+//	POST /apps/{id}/tasks          add tasks (list of TaskData) for app
+//	GET  /apps/{id}/tasks          pending tasks for app
+//	GET  /schedule                 most recent schedule
+//	GET  /vehicles                 vehicles, with current routes
+//	GET  /vehicles/{id}/route      route of vehicle
+//	POST /vehicles/{id}/position   report vehicle position (Location)
+//	GET  /allocation               cumulative allocation
+type Server struct {
+	scheduler *mobius.Scheduler
+	apps      map[int]app.Receiver
+}
+
+// schema for vehicle status
+type VehicleStatus struct {
+	Vehicle common.Vehicle `json:"vehicle"`
+	Route   *vrp.Route     `json:"route"`
+}
+
+// create server for scheduler; tasks can be posted to apps implementing app.Receiver
+func New(s *mobius.Scheduler) *Server {
+	srv := &Server{
+		scheduler: s,
+		apps:      make(map[int]app.Receiver),
+	}
+	for _, a := range s.Applications {
+		if r, ok := a.(app.Receiver); ok {
+			srv.apps[a.GetID()] = r
+		}
+	}
+	return srv
+}
+
+// HTTP handler for all endpoints
+func (srv *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apps/", srv.handle_apps)
+	mux.HandleFunc("/schedule", srv.handle_schedule)
+	mux.HandleFunc("/vehicles", srv.handle_vehicles)
+	mux.HandleFunc("/vehicles/", srv.handle_vehicle)
+	mux.HandleFunc("/allocation", srv.handle_allocation)
+	return mux
+}
+
+// write JSON response
+func write_json(w http.ResponseWriter, status int, x interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(x); err != nil {
+		log.Warnf("[service] error writing response: %v", err)
+	}
+}
+
+// split URL path into (id, action), for paths of form /prefix/{id}/{action}
+func parse_path(path, prefix string) (int, string, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, prefix), "/"), "/")
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid path %s", path)
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid id %s", parts[0])
+	}
+	return id, parts[1], nil
+}
+
+func (srv *Server) handle_apps(w http.ResponseWriter, r *http.Request) {
+	id, action, err := parse_path(r.URL.Path, "/apps/")
+	if err != nil || action != "tasks" {
+		http.NotFound(w, r)
+		return
+	}
+	a, ok := srv.apps[id]
+	if !ok {
+		http.Error(w, fmt.Sprintf("app %d does not accept tasks", id), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		write_json(w, http.StatusOK, a.GetInterestMap().ToFile())
+	case http.MethodPost:
+		var tasks []common.TaskData
+		if err := json.NewDecoder(r.Body).Decode(&tasks); err != nil {
+			http.Error(w, fmt.Sprintf("invalid tasks: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// stamp request time
+		now := srv.scheduler.Now()
+		for i := range tasks {
+			tasks[i].AppID = id
+			tasks[i].RequestTime = now
+		}
+		a.Push(tasks)
+		log.Debugf("[service] app %d: received %d tasks", id, len(tasks))
+		write_json(w, http.StatusAccepted, tasks)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (srv *Server) handle_schedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	write_json(w, http.StatusOK, srv.scheduler.CurrentSchedule())
+}
+
+func (srv *Server) handle_allocation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	write_json(w, http.StatusOK, srv.scheduler.Allocation())
+}
+
+// get vehicles with their routes (routes are indexed like vehicles)
+func (srv *Server) vehicle_status() []VehicleStatus {
+	vehicles := srv.scheduler.GetVehicles()
+	schedule := srv.scheduler.CurrentSchedule()
+	status := make([]VehicleStatus, len(vehicles))
+	for i, v := range vehicles {
+		status[i].Vehicle = v
+		if i < len(schedule.Routes) {
+			status[i].Route = &schedule.Routes[i]
+		}
+	}
+	return status
+}
+
+func (srv *Server) handle_vehicles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	write_json(w, http.StatusOK, srv.vehicle_status())
+}
+
+func (srv *Server) handle_vehicle(w http.ResponseWriter, r *http.Request) {
+	id, action, err := parse_path(r.URL.Path, "/vehicles/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "route" && r.Method == http.MethodGet:
+		for _, v := range srv.vehicle_status() {
+			if v.Vehicle.ID == id {
+				write_json(w, http.StatusOK, v.Route)
+				return
+			}
+		}
+		http.Error(w, fmt.Sprintf("vehicle %d not found", id), http.StatusNotFound)
+	case action == "position" && r.Method == http.MethodPost:
+		var loc common.Location
+		if err := json.NewDecoder(r.Body).Decode(&loc); err != nil {
+			http.Error(w, fmt.Sprintf("invalid location: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := srv.scheduler.SetVehicleLocation(id, loc); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -7,11 +7,27 @@ import (
 
 const EARTH_RADIUS = 6.3781 * 1e6
 
-func travel_time(src, dst common.Location, speed float64, task_time float64) int {
-	dx := (dst.Longitude - src.Longitude) *
-		math.Cos(0.5*(src.Latitude+dst.Latitude)*math.Pi/180) * math.Pi / 180 * EARTH_RADIUS
-	dy := (dst.Latitude - src.Latitude) * math.Pi / 180 * EARTH_RADIUS
-	dist := math.Sqrt(math.Pow(dx, 2) + math.Pow(dy, 2))
-	flight_time := dist / speed
-	return int(math.Ceil(flight_time + task_time))
+// time for vehicle to travel from src to dst (with travel model) and
+// complete task there, departing t seconds into round
+func travel_time(src, dst common.Location, v common.Vehicle, task_time float64, t int) int {
+	return int(math.Ceil(travel_duration(src, dst, v, t) + task_time))
+}
+
+// time for vehicle to travel to task and complete it, departing at time t
+// (waits at task until its window opens; ok is false if it closes before arrival)
+func timed_travel_time(src common.Location, d common.TaskData, v common.Vehicle, t int) (int, bool) {
+	tt := travel_time(src, d.Location, v, v.ServiceTime(d.TaskTimeSeconds), t)
+	arrival := t + travel_time(src, d.Location, v, 0, t)
+	if d.Latest > 0 && arrival > d.Latest {
+		return tt, false
+	}
+	if arrival < d.Earliest {
+		tt += d.Earliest - arrival
+	}
+	return tt, true
+}
+
+// check if task has a time window
+func has_window(d common.TaskData) bool {
+	return d.Earliest > 0 || d.Latest > 0
 }
@@ -2,7 +2,9 @@ package vrp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/mobius-scheduler/mobius/common"
 	log "github.com/sirupsen/logrus"
 	"os"
@@ -21,11 +23,13 @@ type DedicateSolver struct {
 	rth                     []common.Location
 	app_ids                 []int
 	vehicles_per_app        int
+	assignment              [][]int
 	travel_time_matrix_path string
+	Base                    Solver
 }
 
 func (d *DedicateSolver) New() Solver {
-	return &DedicateSolver{}
+	return &DedicateSolver{Base: d.Base}
 }
 
 func (d *DedicateSolver) SetInterestMap(im common.InterestMap) {
@@ -70,20 +74,37 @@ func (d *DedicateSolver) Set(im, uim common.InterestMap, v []common.Vehicle, b,
 		)
 	}
 	d.vehicles_per_app = int(len(d.vehicles) / len(d.app_ids))
+	d.assignment = dedicate_vehicles(d.vehicles, d.app_ids, d.vehicles_per_app)
 }
 
-func (d *DedicateSolver) Solve() Schedule {
+func (d *DedicateSolver) Solve(ctx context.Context) (Schedule, error) {
 	schedules := make([]Schedule, len(d.app_ids))
 	for i, id := range d.app_ids {
-		// setup interestmap, vehicles
+		// setup interestmap, vehicles (skip apps without vehicles)
+		if len(d.assignment[i]) == 0 {
+			continue
+		}
 		ima := d.interest_map.FilterByApp(id)
-		v := d.vehicles[i*d.vehicles_per_app : (i+1)*d.vehicles_per_app]
-		var r []common.Location = nil
-		if d.rth != nil {
-			r = d.rth[i*d.vehicles_per_app : (i+1)*d.vehicles_per_app]
+		v, r := select_vehicles(d.vehicles, d.rth, d.assignment[i])
+
+		// use base solver, if provided
+		if d.Base != nil {
+			solver := d.Base.New()
+			solver.Set(ima, ima, v, d.budget, d.capacity, r)
+			solver.SetTravelTimeMatrixPath(d.travel_time_matrix_path)
+			s, err := solver.Solve(ctx)
+			if err != nil {
+				return Schedule{}, err
+			}
+			schedules[i] = s
+			continue
 		}
 
 		// prepare solver input
+		tt_path, err := external_matrix_path(d.travel_time_matrix_path, ima, v, r)
+		if err != nil {
+			return Schedule{}, err
+		}
 		inp := Input{
 			InterestMap:           ima.ToFile(),
 			UnweightedInterestMap: ima.ToFile(),
@@ -91,13 +112,13 @@ func (d *DedicateSolver) Solve() Schedule {
 			Budget:                d.budget,
 			Capacity:              d.capacity,
 			InitialSchedule:       d.initial_schedule,
-			TravelTimeMatrixPath:  d.travel_time_matrix_path,
+			TravelTimeMatrixPath:  tt_path,
 			RTH:                   r,
 		}
 		inpj := common.ToJSON(inp)
 
 		// run solver
-		cmd := exec.Command("python3", "solvers/vrp_ortools.py")
+		cmd := exec.CommandContext(ctx, "python3", "solvers/vrp_ortools.py")
 		cmd.Dir = common.GetDir()
 		var inpbuf, outbuf bytes.Buffer
 		inpbuf.Write(inpj)
@@ -106,11 +127,11 @@ func (d *DedicateSolver) Solve() Schedule {
 		cmd.Stderr = os.Stderr
 
 		if err := cmd.Run(); err != nil {
-			log.Fatalf("[vrp] error running ortools: %v", err)
+			return Schedule{}, fmt.Errorf("[vrp] error running ortools: %v", err)
 		}
 
 		if err := json.Unmarshal(outbuf.Bytes(), &schedules[i]); err != nil {
-			log.Fatalf(
+			return Schedule{}, fmt.Errorf(
 				"[vrp] error unmarshaling json to output struct: %v",
 				err,
 			)
@@ -118,15 +139,64 @@ func (d *DedicateSolver) Solve() Schedule {
 	}
 
 	// merge schedules
-	var master_schedule Schedule
-	master_schedule.Allocation = make(Allocation)
-	for i, id := range d.app_ids {
-		master_schedule.Routes = append(
-			master_schedule.Routes,
-			schedules[i].Routes...,
-		)
-		master_schedule.Allocation[id] = schedules[i].Allocation[id]
-	}
+	master_schedule := merge_dedicated(schedules, d.assignment, d.app_ids, d.vehicles)
 	master_schedule.Stats.Alpha = -1
-	return master_schedule
+	return master_schedule, nil
+}
+
+// assign vehicles to apps: in order, each vehicle goes to the first app it
+// may serve that has fewer than per_app vehicles (i.e., contiguous slices
+// if no vehicle has allowed apps); returns vehicle indices for each app
+func dedicate_vehicles(vehicles []common.Vehicle, app_ids []int, per_app int) [][]int {
+	assignment := make([][]int, len(app_ids))
+	for j, v := range vehicles {
+		for i, id := range app_ids {
+			if len(assignment[i]) < per_app && v.CanServe(id) {
+				assignment[i] = append(assignment[i], j)
+				break
+			}
+		}
+	}
+	for i, id := range app_ids {
+		if len(assignment[i]) == 0 {
+			log.Warnf("[vrp] no vehicle dedicated to app %d", id)
+		}
+	}
+	return assignment
+}
+
+// vehicles (and RTH locations, if any) with given indices
+func select_vehicles(vehicles []common.Vehicle, rth []common.Location, idx []int) ([]common.Vehicle, []common.Location) {
+	v := make([]common.Vehicle, len(idx))
+	var r []common.Location = nil
+	if rth != nil {
+		r = make([]common.Location, len(idx))
+	}
+	for k, j := range idx {
+		v[k] = vehicles[j]
+		if rth != nil {
+			r[k] = rth[j]
+		}
+	}
+	return v, r
+}
+
+// merge per-app schedules, with routes in vehicle order
+// (vehicles not dedicated to any app stay idle)
+func merge_dedicated(schedules []Schedule, assignment [][]int, app_ids []int, vehicles []common.Vehicle) Schedule {
+	var s Schedule
+	s.Allocation = make(Allocation)
+	s.Routes = make([]Route, len(vehicles))
+	for j, v := range vehicles {
+		s.Routes[j] = Route{VehicleStart: v.Location, VehicleEnd: v.Location}
+	}
+	for i, id := range app_ids {
+		for k, j := range assignment[i] {
+			if k < len(schedules[i].Routes) {
+				s.Routes[j] = schedules[i].Routes[k]
+			}
+		}
+		s.Allocation[id] = schedules[i].Allocation[id]
+	}
+	return s
 }
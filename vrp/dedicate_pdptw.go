@@ -1,6 +1,7 @@
 package vrp
 
 import (
+	"context"
 	"github.com/mobius-scheduler/mobius/common"
 	log "github.com/sirupsen/logrus"
 )
@@ -17,6 +18,7 @@ type DedicatePdptwSolver struct {
 	rth                     []common.Location
 	app_ids                 []int
 	vehicles_per_app        int
+	assignment              [][]int
 	travel_time_matrix_path string
 }
 
@@ -66,34 +68,30 @@ func (d *DedicatePdptwSolver) Set(im, uim common.InterestMap, v []common.Vehicle
 		)
 	}
 	d.vehicles_per_app = int(len(d.vehicles) / len(d.app_ids))
+	d.assignment = dedicate_vehicles(d.vehicles, d.app_ids, d.vehicles_per_app)
 }
 
-func (d *DedicatePdptwSolver) Solve() Schedule {
+func (d *DedicatePdptwSolver) Solve(ctx context.Context) (Schedule, error) {
 	schedules := make([]Schedule, len(d.app_ids))
 	for i, id := range d.app_ids {
-		// setup interestmap, vehicles
-		ima := d.interest_map.FilterByApp(id)
-		v := d.vehicles[i*d.vehicles_per_app : (i+1)*d.vehicles_per_app]
-		var r []common.Location = nil
-		if d.rth != nil {
-			r = d.rth[i*d.vehicles_per_app : (i+1)*d.vehicles_per_app]
+		// setup interestmap, vehicles (skip apps without vehicles)
+		if len(d.assignment[i]) == 0 {
+			continue
 		}
+		ima := d.interest_map.FilterByApp(id)
+		v, r := select_vehicles(d.vehicles, d.rth, d.assignment[i])
 
 		solver := NewPdptwSolver(ima, ima, v, d.budget, d.capacity, r)
 		solver.SetTravelTimeMatrixPath(d.travel_time_matrix_path)
-		schedules[i] = solver.Solve()
+		s, err := solver.Solve(ctx)
+		if err != nil {
+			return Schedule{}, err
+		}
+		schedules[i] = s
 	}
 
 	// merge schedules
-	var master_schedule Schedule
-	master_schedule.Allocation = make(Allocation)
-	for i, id := range d.app_ids {
-		master_schedule.Routes = append(
-			master_schedule.Routes,
-			schedules[i].Routes...,
-		)
-		master_schedule.Allocation[id] = schedules[i].Allocation[id]
-	}
+	master_schedule := merge_dedicated(schedules, d.assignment, d.app_ids, d.vehicles)
 	master_schedule.Stats.Alpha = -1
-	return master_schedule
+	return master_schedule, nil
 }
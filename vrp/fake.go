@@ -0,0 +1,198 @@
+package vrp
+
+import (
+	"context"
+	"github.com/mobius-scheduler/mobius/common"
+	"math"
+	"sync/atomic"
+)
+
+// set of achievable allocations, known in closed form
+// (stands in for the VRP, e.g. to check the frontier search)
+type Frontier interface {
+	// allocation maximizing weighted reward sum_i w_i * x_i
+	Best(w map[int]float64) Allocation
+}
+
+// frontier spanned by a finite set of allocations (scripted frontier);
+// ties go to the first allocation
+type PointFrontier []Allocation
+
+func (f PointFrontier) Best(w map[int]float64) Allocation {
+	var best Allocation
+	best_reward := math.Inf(-1)
+	for _, a := range f {
+		var reward float64
+		for id, x := range a {
+			reward += w[id] * x
+		}
+		if reward > best_reward {
+			best, best_reward = a, reward
+		}
+	}
+	return best
+}
+
+// concave frontier sum_i (x_i / Scale_i)^P = 1 (P > 1), over apps in Scale
+type NormFrontier struct {
+	Scale map[int]float64
+	P     float64
+}
+
+func (f NormFrontier) Best(w map[int]float64) Allocation {
+	// maximizer of w.x on the unit P-ball (in scaled coordinates y_i = x_i / s_i)
+	// is y_i = v_i^(q-1) / |v|_q^(q-1), with v_i = w_i * s_i and 1/P + 1/q = 1
+	q := f.P / (f.P - 1)
+	var norm float64
+	for id, s := range f.Scale {
+		norm += math.Pow(math.Max(0, w[id])*s, q)
+	}
+	norm = math.Pow(norm, 1/q)
+
+	a := make(Allocation)
+	for id, s := range f.Scale {
+		if norm == 0 {
+			a[id] = 0
+			continue
+		}
+		v := math.Max(0, w[id]) * s
+		a[id] = s * math.Pow(v/norm, q-1)
+	}
+	return a
+}
+
+// in-process solver for tests: returns frontier's best allocation for
+// weights implied by (weighted vs unweighted) InterestMap, with pending
+// tasks of each app routed (on first vehicle) until allocation is covered
+type FakeSolver struct {
+	Frontier                Frontier
+	interest_map            common.InterestMap
+	unweighted_interest_map common.InterestMap
+	vehicles                []common.Vehicle
+	budget                  int
+	capacity                int
+	initial_schedule        Schedule
+	rth                     []common.Location
+	travel_time_matrix_path string
+	// solve calls, shared by instances from New
+	calls *int64
+}
+
+func NewFakeSolver(f Frontier) *FakeSolver {
+	return &FakeSolver{Frontier: f, calls: new(int64)}
+}
+
+func (f *FakeSolver) New() Solver {
+	if f.calls == nil {
+		f.calls = new(int64)
+	}
+	return &FakeSolver{Frontier: f.Frontier, calls: f.calls}
+}
+
+// number of solve calls (by this solver and instances from New)
+func (f *FakeSolver) Calls() int {
+	if f.calls == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(f.calls))
+}
+
+func (f *FakeSolver) SetInterestMap(im common.InterestMap) {
+	f.interest_map = im
+}
+
+func (f *FakeSolver) GetInterestMap() common.InterestMap {
+	return f.interest_map
+}
+
+func (f *FakeSolver) GetRTH() []common.Location {
+	return f.rth
+}
+
+func (f *FakeSolver) SetInitialSchedule(s Schedule) {
+	f.initial_schedule = s
+}
+
+func (f *FakeSolver) SetTravelTimeMatrixPath(p string) {
+	f.travel_time_matrix_path = p
+}
+
+func (f *FakeSolver) GetTravelTimeMatrixPath() string {
+	return f.travel_time_matrix_path
+}
+
+func (f *FakeSolver) Set(im, uim common.InterestMap, v []common.Vehicle, b, c int, r []common.Location) {
+	f.interest_map = im
+	f.unweighted_interest_map = uim
+	f.vehicles = v
+	f.budget = b
+	f.capacity = c
+	f.rth = r
+}
+
+// weight of each app: ratio of weighted to unweighted interest
+// (1 if InterestMap is not weighted)
+func (f *FakeSolver) weights() map[int]float64 {
+	w := make(map[int]float64)
+	for _, t := range f.interest_map.GetTasks() {
+		if _, ok := w[t.AppID]; ok {
+			continue
+		}
+		w[t.AppID] = 1
+		if d, ok := f.unweighted_interest_map[t]; ok && d.Interest > 0 {
+			w[t.AppID] = f.interest_map[t].Interest / d.Interest
+		}
+	}
+	return w
+}
+
+func (f *FakeSolver) Solve(ctx context.Context) (Schedule, error) {
+	if err := ctx.Err(); err != nil {
+		return Schedule{}, err
+	}
+	if f.calls != nil {
+		atomic.AddInt64(f.calls, 1)
+	}
+	uim := f.unweighted_interest_map
+	if uim == nil {
+		uim = f.interest_map
+	}
+
+	var s Schedule
+	s.Allocation = make(Allocation)
+	for _, id := range uim.GetApps() {
+		s.Allocation[id] = 0
+	}
+	best := f.Frontier.Best(f.weights())
+	for id, x := range best {
+		if _, ok := s.Allocation[id]; ok {
+			s.Allocation[id] = x
+		}
+	}
+
+	// one route per vehicle; tasks go on first route, evenly spaced
+	// over budget, in canonical order
+	for _, v := range f.vehicles {
+		s.Routes = append(s.Routes, Route{VehicleStart: v.Location, VehicleEnd: v.Location})
+	}
+	if len(s.Routes) == 0 {
+		return s, nil
+	}
+	r := &s.Routes[0]
+	covered := make(Allocation)
+	for _, t := range uim.GetTasks() {
+		d := uim[t]
+		if covered[d.AppID] >= s.Allocation[d.AppID] {
+			continue
+		}
+		covered[d.AppID] += d.Interest
+		r.Path = append(r.Path, d)
+		r.TotalInterest += d.Interest
+		r.VehicleEnd = d.Location
+	}
+	for i := range r.Path {
+		r.Path[i].FulfillTime = f.budget * (i + 1) / len(r.Path)
+	}
+	r.TotalTime = f.budget
+	return s, nil
+}
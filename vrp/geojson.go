@@ -0,0 +1,148 @@
+package vrp
+
+import (
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+// colors for styling features (simplestyle), by app or vehicle
+var GEOJSON_COLORS = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+	"#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf",
+}
+
+// GeoJSON (RFC 7946) geometry: coordinates are [longitude, latitude]
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// travel model that traces geometry of travel between locations
+// (e.g., along roads); other models are drawn as straight lines
+type PathModel interface {
+	Path(src, dst common.Location) []common.Location
+}
+
+// color of app or vehicle (cycles through palette)
+func geojson_color(id int) string {
+	if id < 0 {
+		id = -id
+	}
+	return GEOJSON_COLORS[id%len(GEOJSON_COLORS)]
+}
+
+func geojson_point(loc common.Location) GeoJSONGeometry {
+	return GeoJSONGeometry{Type: "Point", Coordinates: []float64{loc.Longitude, loc.Latitude}}
+}
+
+// role of task in route: pickup (task with destination), dropoff
+// (delivery node, as in PdptwSolver node_map) or task
+func task_role(d common.TaskData) string {
+	if d.Destination.Latitude == common.INVALID_LOC && d.Destination.Longitude == common.INVALID_LOC {
+		return "dropoff"
+	}
+	if has_destination(d.GetTask()) {
+		return "pickup"
+	}
+	return "task"
+}
+
+// locations visited between two stops, including both
+func geojson_leg(model TravelModel, src, dst common.Location) []common.Location {
+	if src == dst {
+		return []common.Location{src}
+	}
+	if p, ok := model.(PathModel); ok {
+		if path := p.Path(src, dst); len(path) > 0 {
+			return append(append([]common.Location{src}, path...), dst)
+		}
+	}
+	return []common.Location{src, dst}
+}
+
+// export schedule as GeoJSON: LineString per route (from vehicle start,
+// through its path, to vehicle end), Point per vehicle start and per task,
+// with simplestyle properties (lines colored by vehicle, tasks by app)
+func (s Schedule) GeoJSON() GeoJSONFeatureCollection {
+	// trace along base model of speed profile
+	model := GetTravelModel()
+	if p, ok := model.(*SpeedProfile); ok {
+		model = p.Base
+	}
+
+	fc := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+	for i, r := range s.Routes {
+		// route
+		stops := []common.Location{r.VehicleStart}
+		for _, t := range r.Path {
+			stops = append(stops, t.Location)
+		}
+		stops = append(stops, r.VehicleEnd)
+		var coords [][]float64
+		for k := 1; k < len(stops); k++ {
+			leg := geojson_leg(model, stops[k-1], stops[k])
+			if len(coords) > 0 {
+				leg = leg[1:]
+			}
+			for _, loc := range leg {
+				coords = append(coords, []float64{loc.Longitude, loc.Latitude})
+			}
+		}
+		if len(coords) < 2 {
+			coords = append(coords, coords[0])
+		}
+		fc.Features = append(fc.Features, GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: GeoJSONGeometry{Type: "LineString", Coordinates: coords},
+			Properties: map[string]interface{}{
+				"vehicle":        i,
+				"total_interest": r.TotalInterest,
+				"total_time":     r.TotalTime,
+				"stroke":         geojson_color(i),
+				"stroke-width":   2,
+			},
+		})
+
+		// vehicle start
+		fc.Features = append(fc.Features, GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: geojson_point(r.VehicleStart),
+			Properties: map[string]interface{}{
+				"vehicle":       i,
+				"role":          "start",
+				"marker-color":  geojson_color(i),
+				"marker-symbol": "car",
+			},
+		})
+
+		// tasks
+		for k, t := range r.Path {
+			fc.Features = append(fc.Features, GeoJSONFeature{
+				Type:     "Feature",
+				Geometry: geojson_point(t.Location),
+				Properties: map[string]interface{}{
+					"vehicle":      i,
+					"stop":         k,
+					"app_id":       t.AppID,
+					"interest":     t.Interest,
+					"request_time": t.RequestTime,
+					"fulfill_time": t.FulfillTime,
+					"role":         task_role(t),
+					"marker-color": geojson_color(t.AppID),
+					"marker-size":  "small",
+				},
+			})
+		}
+	}
+	return fc
+}
@@ -0,0 +1,41 @@
+package vrp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+// one vehicle serving a task of each app, then ending at its last task
+func TestGeoJSONOneRoute(t *testing.T) {
+	home := common.Location{Latitude: 42.36, Longitude: -71.09}
+	a := common.Location{Latitude: 42.37, Longitude: -71.09}
+	b := common.Location{Latitude: 42.37, Longitude: -71.1}
+	s := Schedule{
+		Routes: []Route{{
+			Path: []common.TaskData{
+				{AppID: 1, Location: a, Interest: 2, FulfillTime: 112},
+				{AppID: 2, Location: b, Interest: 1, RequestTime: 5, FulfillTime: 195},
+			},
+			TotalInterest: 3,
+			TotalTime:     195,
+			VehicleStart:  home,
+			VehicleEnd:    b,
+		}},
+		Allocation: Allocation{1: 2, 2: 1},
+	}
+
+	got, err := json.MarshalIndent(s.GeoJSON(), "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("testdata/one_route.geojson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got)+"\n" != string(want) {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
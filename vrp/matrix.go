@@ -0,0 +1,225 @@
+package vrp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/common"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// max matrix files kept on disk (written by this process)
+const MAX_CACHED_MATRICES = 32
+
+// max location pairs kept in memory for incremental updates
+const MAX_CACHED_PAIRS = 1 << 22
+
+// builds travel time matrices for external solvers, cached on disk by
+// hash of location set (and travel model); matrices for new location
+// sets reuse pairs computed for previous sets, so only pairs involving
+// new locations are computed when a few tasks change between rounds
+type MatrixCache struct {
+	Dir     string
+	mu      sync.Mutex
+	params  string
+	pairs   map[location_pair]TravelMatrixEntry
+	written []string
+}
+
+func NewMatrixCache(dir string) *MatrixCache {
+	return &MatrixCache{
+		Dir:   dir,
+		pairs: make(map[location_pair]TravelMatrixEntry),
+	}
+}
+
+// cache used for external solvers (in temporary directory by default)
+var matrix_cache = NewMatrixCache(filepath.Join(os.TempDir(), "mobius-tt"))
+
+// set directory of matrix cache used for external solvers
+func SetMatrixCacheDir(dir string) {
+	matrix_cache.mu.Lock()
+	defer matrix_cache.mu.Unlock()
+	matrix_cache.Dir = dir
+}
+
+// unique locations, sorted by latitude and longitude
+func sorted_locations(locs []common.Location) []common.Location {
+	var unique []common.Location
+	seen := make(map[common.Location]bool)
+	for _, l := range locs {
+		if !seen[l] {
+			seen[l] = true
+			unique = append(unique, l)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		if unique[i].Latitude != unique[j].Latitude {
+			return unique[i].Latitude < unique[j].Latitude
+		}
+		return unique[i].Longitude < unique[j].Longitude
+	})
+	return unique
+}
+
+// everything besides locations that travel times depend on:
+// travel model, vehicle speed and (for time-dependent models) round start
+func matrix_params(v common.Vehicle) string {
+	travel.RLock()
+	defer travel.RUnlock()
+	p := fmt.Sprintf("%T/%v", travel.model, v.Speed)
+	if m, ok := travel.model.(*TravelMatrix); ok {
+		p += "/" + m.Path
+	}
+	if _, ok := travel.model.(*SpeedProfile); ok {
+		p += "/" + strconv.Itoa(travel.start)
+	}
+	return p
+}
+
+// hash of parameters and location set
+func matrix_key(params string, locs []common.Location) string {
+	h := sha256.New()
+	h.Write([]byte(params))
+	for _, l := range locs {
+		fmt.Fprintf(h, "\n%s,%s",
+			strconv.FormatFloat(l.Latitude, 'g', -1, 64),
+			strconv.FormatFloat(l.Longitude, 'g', -1, 64),
+		)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// path of matrix file for locations (built if not cached)
+func (c *MatrixCache) Path(locs []common.Location, v common.Vehicle) (string, error) {
+	unique := sorted_locations(locs)
+	params := matrix_params(v)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path := filepath.Join(c.Dir, "tt_"+matrix_key(params, unique)+".json")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	// pairs from previous sets are only valid for same parameters
+	if params != c.params || len(c.pairs) > MAX_CACHED_PAIRS {
+		c.params = params
+		c.pairs = make(map[location_pair]TravelMatrixEntry)
+	}
+
+	model := GetTravelModel()
+	entries := make([]TravelMatrixEntry, 0, len(unique)*len(unique))
+	var added int
+	for _, src := range unique {
+		for _, dst := range unique {
+			p := location_pair{src, dst}
+			e, ok := c.pairs[p]
+			if !ok {
+				e = TravelMatrixEntry{
+					Src:        src,
+					Dst:        dst,
+					TravelTime: travel_duration(src, dst, v, 0),
+					Distance:   model.Distance(src, dst),
+				}
+				c.pairs[p] = e
+				added++
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	if err := write_matrix_file(path, entries); err != nil {
+		return "", err
+	}
+	log.Debugf(
+		"[vrp] built travel time matrix %s: %d locations, %d of %d pairs computed",
+		path, len(unique), added, len(entries),
+	)
+
+	// bound number of files on disk
+	c.written = append(c.written, path)
+	if len(c.written) > MAX_CACHED_MATRICES {
+		os.Remove(c.written[0])
+		c.written = c.written[1:]
+	}
+	return path, nil
+}
+
+// write matrix atomically (other processes may read cache directory)
+func write_matrix_file(path string, entries []TravelMatrixEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tt-*.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(entries); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// check that external solvers can be given travel times of fleet: they
+// read a single matrix, so for models they do not implement, all
+// vehicles must travel at same speed
+func CheckExternalFleet(v []common.Vehicle) error {
+	if travel_model_builtin() {
+		return nil
+	}
+	for _, x := range v {
+		if x.Speed != v[0].Speed {
+			return fmt.Errorf(
+				"[vrp] travel time matrix for external solvers needs vehicles of equal speed: vehicle %d has speed %v, vehicle %d has %v",
+				v[0].ID, v[0].Speed, x.ID, x.Speed,
+			)
+		}
+	}
+	return nil
+}
+
+// travel time matrix for external solver: path, if set, else (for models
+// that external solvers do not implement) a matrix for vehicles, RTH and
+// task locations from cache
+func external_matrix_path(path string, im common.InterestMap, v []common.Vehicle, r []common.Location) (string, error) {
+	if path != "" || travel_model_builtin() || len(v) == 0 {
+		return path, nil
+	}
+	if err := CheckExternalFleet(v); err != nil {
+		return "", err
+	}
+
+	var locs []common.Location
+	for _, x := range v {
+		locs = append(locs, x.Location)
+	}
+	locs = append(locs, r...)
+	for _, t := range im.GetTasks() {
+		locs = append(locs, t.Location)
+		if t.Destination != (common.Location{}) &&
+			t.Destination.Latitude != common.INVALID_LOC {
+			locs = append(locs, t.Destination)
+		}
+	}
+
+	// travel times for first vehicle (all travel at same speed)
+	p, err := matrix_cache.Path(locs, v[0])
+	if err != nil {
+		return "", fmt.Errorf("[vrp] error writing travel time matrix: %v", err)
+	}
+	return p, nil
+}
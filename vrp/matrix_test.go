@@ -0,0 +1,86 @@
+package vrp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+func TestExternalMatrixRejectsMixedSpeeds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetTravelModel(Equirectangular{})
+	defer SetMatrixCacheDir(matrix_cache.Dir)
+	SetMatrixCacheDir(dir)
+
+	home := common.Location{Latitude: 42.36, Longitude: -71.09}
+	task := common.TaskData{AppID: 1, Location: common.Location{Latitude: 42.37, Longitude: -71.09}, Interest: 1}
+	im := common.InterestMap{task.GetTask(): task}
+	mixed := []common.Vehicle{{ID: 0, Location: home, Speed: 10}, {ID: 1, Location: home, Speed: 5}}
+
+	// default model is implemented by external solvers: no matrix needed
+	if err := CheckExternalFleet(mixed); err != nil {
+		t.Errorf("default model: %v", err)
+	}
+
+	SetTravelModel(Haversine{})
+	if err := CheckExternalFleet(mixed); err == nil {
+		t.Error("expected error for mixed speeds")
+	}
+	if _, err := external_matrix_path("", im, mixed, nil); err == nil {
+		t.Error("built matrix for mixed speeds")
+	}
+	same := []common.Vehicle{{ID: 0, Location: home, Speed: 10}, {ID: 1, Location: home, Speed: 10}}
+	if p, err := external_matrix_path("", im, same, nil); err != nil || p == "" {
+		t.Errorf("got path %q, error %v for equal speeds", p, err)
+	}
+}
+
+// cache keys name files on disk, which outlive a run: key of location set
+// must not depend on order or duplicates, nor change between releases
+func TestMatrixCacheKeyStable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := common.Location{Latitude: 42.36, Longitude: -71.09}
+	b := common.Location{Latitude: 42.37, Longitude: -71.1}
+	key := matrix_key("vrp.Haversine/10", sorted_locations([]common.Location{b, a, b}))
+	if want := "d660c527f13b3400eee7899ab454ba06"; key != want {
+		t.Errorf("got key %s, want %s", key, want)
+	}
+
+	defer SetTravelModel(Equirectangular{})
+	SetTravelModel(Haversine{})
+	c := NewMatrixCache(dir)
+	v := common.Vehicle{Speed: 10}
+	p1, err := c.Path([]common.Location{a, b}, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := NewMatrixCache(dir).Path([]common.Location{b, a, a}, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p1 != p2 {
+		t.Errorf("same locations got files %s and %s", p1, p2)
+	}
+	if p1 != filepath.Join(dir, "tt_"+key+".json") {
+		t.Errorf("got file %s, want key %s", p1, key)
+	}
+	p3, err := c.Path([]common.Location{a, b}, common.Vehicle{Speed: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p3 == p1 {
+		t.Error("different speeds share matrix file")
+	}
+}
@@ -0,0 +1,517 @@
+package vrp
+
+import (
+	"context"
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+// default number of local search passes in native solver
+const NATIVE_MAX_ITERATIONS = 50
+
+// native VRP solver (pure Go): insertion construction + local search;
+// capacity is a hard cap on the (unweighted) interest served by a route,
+// unlike the ortools solver, which trades interest off against time
+// (see CAPACITY_TASK_BIAS in vrp_ortools.py)
+type NativeSolver struct {
+	interest_map            common.InterestMap
+	vehicles                []common.Vehicle
+	budget                  int
+	capacity                int
+	unweighted_interest_map common.InterestMap
+	initial_schedule        Schedule
+	rth                     []common.Location
+	travel_time_matrix_path string
+	MaxIterations           int
+}
+
+func (n *NativeSolver) New() Solver {
+	return &NativeSolver{MaxIterations: n.MaxIterations}
+}
+
+func NewNativeSolver(im, uim common.InterestMap, v []common.Vehicle, b, c int, r []common.Location) *NativeSolver {
+	s := &NativeSolver{}
+	s.Set(im, uim, v, b, c, r)
+	return s
+}
+
+func (n *NativeSolver) SetInterestMap(im common.InterestMap) {
+	n.interest_map = im
+}
+
+func (n *NativeSolver) GetInterestMap() common.InterestMap {
+	return n.interest_map
+}
+
+func (n *NativeSolver) GetRTH() []common.Location {
+	return n.rth
+}
+
+func (n *NativeSolver) SetInitialSchedule(s Schedule) {
+	n.initial_schedule = s
+}
+
+func (n *NativeSolver) SetTravelTimeMatrixPath(p string) {
+	n.travel_time_matrix_path = p
+}
+
+func (n *NativeSolver) GetTravelTimeMatrixPath() string {
+	return n.travel_time_matrix_path
+}
+
+func (n *NativeSolver) Set(im, uim common.InterestMap, v []common.Vehicle, b, c int, r []common.Location) {
+	n.interest_map = im
+	n.unweighted_interest_map = uim
+	n.vehicles = v
+	n.budget = b
+	n.capacity = c
+	n.rth = r
+}
+
+// task (node) considered by native solver
+type native_node struct {
+	data   common.TaskData
+	weight float64
+	value  float64
+}
+
+// route under construction: indices into node list
+type native_route struct {
+	vehicle  common.Vehicle
+	home     *common.Location
+	path     []int
+	budget   int
+	capacity int
+}
+
+// state of native search
+type native_state struct {
+	nodes  []native_node
+	routes []native_route
+	routed []bool
+	// some node has a time window (or travel times depend on time)
+	timed bool
+}
+
+// travel time from location to node (including task time at node),
+// departing at time t
+func (ns *native_state) leg(v common.Vehicle, src common.Location, dst int, t int) int {
+	d := ns.nodes[dst].data
+	return travel_time(src, d.Location, v, v.ServiceTime(d.TaskTimeSeconds), t)
+}
+
+// travel time from location to end of route (home, if RTH)
+func (ns *native_state) leg_home(r *native_route, src common.Location, t int) int {
+	if r.home == nil {
+		return 0
+	}
+	return travel_time(src, *r.home, r.vehicle, 0, t)
+}
+
+// location of path element at position i (-1 is vehicle start)
+func (ns *native_state) location(r *native_route, path []int, i int) common.Location {
+	if i < 0 {
+		return r.vehicle.Location
+	}
+	return ns.nodes[path[i]].data.Location
+}
+
+// completion time of each node in path, and total time including return home
+// (waiting for time windows to open); ok is false if a window is missed
+func (ns *native_state) path_schedule(r *native_route, path []int) ([]int, int, bool) {
+	var t int
+	ok := true
+	done := make([]int, len(path))
+	loc := r.vehicle.Location
+	for i, idx := range path {
+		tt, in_window := timed_travel_time(loc, ns.nodes[idx].data, r.vehicle, t)
+		ok = ok && in_window
+		t += tt
+		done[i] = t
+		loc = ns.nodes[idx].data.Location
+	}
+	return done, t + ns.leg_home(r, loc, t), ok
+}
+
+// total time of path, including return home
+func (ns *native_state) path_time(r *native_route, path []int) int {
+	if ns.timed {
+		_, t, _ := ns.path_schedule(r, path)
+		return t
+	}
+	var t int
+	loc := r.vehicle.Location
+	for _, idx := range path {
+		t += ns.leg(r.vehicle, loc, idx, t)
+		loc = ns.nodes[idx].data.Location
+	}
+	return t + ns.leg_home(r, loc, t)
+}
+
+// total load of path
+func (ns *native_state) path_load(path []int) float64 {
+	var load float64
+	for _, idx := range path {
+		load += ns.nodes[idx].value
+	}
+	return load
+}
+
+// check if vehicle of route may serve node
+func (ns *native_state) allowed(r *native_route, node int) bool {
+	return r.vehicle.CanServe(ns.nodes[node].data.AppID)
+}
+
+// check budget, capacity, allowed app and time window constraints for path
+func (ns *native_state) feasible(r *native_route, path []int) bool {
+	if r.capacity > 0 && ns.path_load(path) > float64(r.capacity) {
+		return false
+	}
+	for _, idx := range path {
+		if !ns.allowed(r, idx) {
+			return false
+		}
+	}
+	if ns.timed {
+		_, t, ok := ns.path_schedule(r, path)
+		return ok && t <= r.budget
+	}
+	return ns.path_time(r, path) <= r.budget
+}
+
+// extra time incurred by inserting node before position pos
+// (travel times independent of departure time)
+func (ns *native_state) insertion_delta(r *native_route, node, pos int) int {
+	prev := ns.location(r, r.path, pos-1)
+	delta := ns.leg(r.vehicle, prev, node, 0)
+	at := ns.nodes[node].data.Location
+	if pos < len(r.path) {
+		delta += ns.leg(r.vehicle, at, r.path[pos], 0) - ns.leg(r.vehicle, prev, r.path[pos], 0)
+	} else {
+		delta += ns.leg_home(r, at, 0) - ns.leg_home(r, prev, 0)
+	}
+	return delta
+}
+
+// insert node into path at position pos (returns new slice)
+func insert_at(path []int, node, pos int) []int {
+	x := make([]int, 0, len(path)+1)
+	x = append(x, path[:pos]...)
+	x = append(x, node)
+	return append(x, path[pos:]...)
+}
+
+// remove element at position pos from path (returns new slice)
+func remove_at(path []int, pos int) []int {
+	x := make([]int, 0, len(path))
+	x = append(x, path[:pos]...)
+	return append(x, path[pos+1:]...)
+}
+
+// seed routes with initial schedule, dropping unknown or infeasible tasks
+func (ns *native_state) warm_start(init Schedule, index map[common.Task]int) {
+	for i, route := range init.Routes {
+		if i >= len(ns.routes) {
+			break
+		}
+		r := &ns.routes[i]
+		for _, t := range route.Path {
+			idx, ok := index[t.GetTask()]
+			if !ok || ns.routed[idx] {
+				continue
+			}
+			path := append(append([]int{}, r.path...), idx)
+			if ns.feasible(r, path) {
+				r.path = path
+				ns.routed[idx] = true
+			}
+		}
+	}
+}
+
+// greedily insert unrouted nodes with best interest per extra second
+func (ns *native_state) insert() bool {
+	improved := false
+	for {
+		best_ratio := -1.0
+		var best_node, best_route, best_pos int
+		for node := range ns.nodes {
+			if ns.routed[node] || ns.nodes[node].weight <= 0 {
+				continue
+			}
+			for ri := range ns.routes {
+				r := &ns.routes[ri]
+				if !ns.allowed(r, node) {
+					continue
+				}
+				if r.capacity > 0 &&
+					ns.path_load(r.path)+ns.nodes[node].value > float64(r.capacity) {
+					continue
+				}
+				base := ns.path_time(r, r.path)
+				for pos := 0; pos <= len(r.path); pos++ {
+					delta := ns.insertion_delta(r, node, pos)
+
+					// with time windows (or time-dependent travel),
+					// delta is not additive
+					if ns.timed {
+						x := insert_at(r.path, node, pos)
+						if !ns.feasible(r, x) {
+							continue
+						}
+						delta = ns.path_time(r, x) - base
+					} else if base+delta > r.budget {
+						continue
+					}
+					ratio := ns.nodes[node].weight / float64(1+delta)
+					if ratio > best_ratio {
+						best_ratio = ratio
+						best_node, best_route, best_pos = node, ri, pos
+					}
+				}
+			}
+		}
+		if best_ratio < 0 {
+			return improved
+		}
+		r := &ns.routes[best_route]
+		r.path = insert_at(r.path, best_node, best_pos)
+		ns.routed[best_node] = true
+		improved = true
+	}
+}
+
+// reverse path segments within a route when it shortens the route
+func (ns *native_state) two_opt(r *native_route) bool {
+	improved := false
+	best := ns.path_time(r, r.path)
+	for i := 0; i < len(r.path)-1; i++ {
+		for j := i + 1; j < len(r.path); j++ {
+			x := append([]int{}, r.path...)
+			for a, b := i, j; a < b; a, b = a+1, b-1 {
+				x[a], x[b] = x[b], x[a]
+			}
+			if t := ns.path_time(r, x); t < best && (!ns.timed || ns.feasible(r, x)) {
+				r.path = x
+				best = t
+				improved = true
+			}
+		}
+	}
+	return improved
+}
+
+// move a node to another position (or route) when it saves time
+func (ns *native_state) relocate() bool {
+	for ai := range ns.routes {
+		a := &ns.routes[ai]
+		for i := 0; i < len(a.path); i++ {
+			node := a.path[i]
+			pa := remove_at(a.path, i)
+			if !ns.feasible(a, pa) {
+				continue
+			}
+			before_a := ns.path_time(a, a.path)
+			after_a := ns.path_time(a, pa)
+			for bi := range ns.routes {
+				b := &ns.routes[bi]
+
+				// move within same route
+				if bi == ai {
+					for pos := 0; pos <= len(pa); pos++ {
+						x := insert_at(pa, node, pos)
+						if pos != i && ns.path_time(a, x) < before_a && ns.feasible(a, x) {
+							a.path = x
+							return true
+						}
+					}
+					continue
+				}
+
+				// move to other route
+				before_b := ns.path_time(b, b.path)
+				for pos := 0; pos <= len(b.path); pos++ {
+					pb := insert_at(b.path, node, pos)
+					if !ns.feasible(b, pb) {
+						continue
+					}
+					if after_a+ns.path_time(b, pb) < before_a+before_b {
+						a.path = pa
+						b.path = pb
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// swap nodes between two routes when it saves time
+func (ns *native_state) exchange() bool {
+	for ai := range ns.routes {
+		a := &ns.routes[ai]
+		for bi := ai + 1; bi < len(ns.routes); bi++ {
+			b := &ns.routes[bi]
+			before := ns.path_time(a, a.path) + ns.path_time(b, b.path)
+			for i := range a.path {
+				for j := range b.path {
+					pa := append([]int{}, a.path...)
+					pb := append([]int{}, b.path...)
+					pa[i], pb[j] = b.path[j], a.path[i]
+					if !ns.feasible(a, pa) || !ns.feasible(b, pb) {
+						continue
+					}
+					if ns.path_time(a, pa)+ns.path_time(b, pb) < before {
+						a.path = pa
+						b.path = pb
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// replace a routed node with a more valuable unrouted node
+func (ns *native_state) swap_in() bool {
+	for ri := range ns.routes {
+		r := &ns.routes[ri]
+		for i, old := range r.path {
+			for node := range ns.nodes {
+				if ns.routed[node] || ns.nodes[node].weight <= ns.nodes[old].weight {
+					continue
+				}
+				x := append([]int{}, r.path...)
+				x[i] = node
+				if ns.feasible(r, x) {
+					r.path = x
+					ns.routed[old] = false
+					ns.routed[node] = true
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// convert search state into schedule
+func (ns *native_state) to_schedule(uim common.InterestMap) Schedule {
+	var s Schedule
+	s.Allocation = make(Allocation)
+	for _, id := range uim.GetApps() {
+		s.Allocation[id] = 0
+	}
+
+	for ri := range ns.routes {
+		r := &ns.routes[ri]
+		route := Route{
+			VehicleStart: r.vehicle.Location,
+			VehicleEnd:   r.vehicle.Location,
+			Path:         make([]common.TaskData, 0, len(r.path)),
+		}
+		done, t, _ := ns.path_schedule(r, r.path)
+		for i, idx := range r.path {
+			data := ns.nodes[idx].data
+			data.Interest = ns.nodes[idx].value
+			data.FulfillTime = done[i]
+			route.Path = append(route.Path, data)
+			route.TotalInterest += data.Interest
+			s.Allocation[data.AppID] += data.Interest
+			route.VehicleEnd = data.Location
+		}
+		if r.home != nil {
+			route.VehicleEnd = *r.home
+		}
+		route.TotalTime = t
+		s.Routes = append(s.Routes, route)
+	}
+	return s
+}
+
+// build search state (no routed nodes), with index of nodes by task,
+// and unweighted InterestMap
+func (n *NativeSolver) state() (native_state, map[common.Task]int, common.InterestMap) {
+	uim := n.unweighted_interest_map
+	if uim == nil {
+		uim = n.interest_map
+	}
+
+	// build node list in canonical order
+	tasks := n.interest_map.GetTasks()
+	ns := native_state{
+		nodes:  make([]native_node, len(tasks)),
+		routed: make([]bool, len(tasks)),
+	}
+	ns.timed = travel_model_timed()
+	index := make(map[common.Task]int)
+	for i, t := range tasks {
+		value := n.interest_map[t].Interest
+		if d, ok := uim[t]; ok {
+			value = d.Interest
+		}
+		ns.nodes[i] = native_node{
+			data:   n.interest_map[t],
+			weight: n.interest_map[t].Interest,
+			value:  value,
+		}
+		ns.timed = ns.timed || has_window(n.interest_map[t])
+		index[t] = i
+	}
+
+	// one route per vehicle (with its own limits), ending at home if RTH
+	ns.routes = make([]native_route, len(n.vehicles))
+	for i, v := range n.vehicles {
+		ns.routes[i].vehicle = v
+		ns.routes[i].budget = v.GetBudget(n.budget)
+		ns.routes[i].capacity = v.GetCapacity(n.capacity)
+		if n.rth != nil {
+			ns.routes[i].home = &n.rth[i]
+		}
+	}
+	return ns, index, uim
+}
+
+// search stops early (returning best schedule so far) if context is done
+func (n *NativeSolver) Solve(ctx context.Context) (Schedule, error) {
+	if err := ctx.Err(); err != nil {
+		return Schedule{}, err
+	}
+	ns, index, uim := n.state()
+
+	// construct: warm start, then insertion
+	ns.warm_start(n.initial_schedule, index)
+	ns.insert()
+
+	// improve: local search to free up time, then insert more tasks
+	iterations := n.MaxIterations
+	if iterations <= 0 {
+		iterations = NATIVE_MAX_ITERATIONS
+	}
+	for it := 0; it < iterations && ctx.Err() == nil; it++ {
+		improved := false
+		for ri := range ns.routes {
+			if ns.two_opt(&ns.routes[ri]) {
+				improved = true
+			}
+		}
+		if ns.relocate() {
+			improved = true
+		}
+		if ns.exchange() {
+			improved = true
+		}
+		if ns.swap_in() {
+			improved = true
+		}
+		if ns.insert() {
+			improved = true
+		}
+		if !improved {
+			break
+		}
+	}
+
+	return ns.to_schedule(uim), nil
+}
@@ -0,0 +1,410 @@
+package vrp
+
+import (
+	"context"
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+// native pickup-and-delivery solver (pure Go): each task with a destination
+// is a request, picked up at its location and delivered at its destination
+// by the same vehicle; output follows PdptwSolver conventions (pickup keyed
+// by task, delivery by task at destination with INVALID_LOC destination)
+type NativePdptwSolver struct {
+	interest_map            common.InterestMap
+	vehicles                []common.Vehicle
+	budget                  int
+	capacity                int
+	unweighted_interest_map common.InterestMap
+	initial_schedule        Schedule
+	rth                     []common.Location
+	travel_time_matrix_path string
+	MaxIterations           int
+}
+
+func (n *NativePdptwSolver) New() Solver {
+	return &NativePdptwSolver{MaxIterations: n.MaxIterations}
+}
+
+func NewNativePdptwSolver(im, uim common.InterestMap, v []common.Vehicle, b, c int, r []common.Location) *NativePdptwSolver {
+	s := &NativePdptwSolver{}
+	s.Set(im, uim, v, b, c, r)
+	return s
+}
+
+func (n *NativePdptwSolver) SetInterestMap(im common.InterestMap) {
+	n.interest_map = im
+}
+
+func (n *NativePdptwSolver) GetInterestMap() common.InterestMap {
+	return n.interest_map
+}
+
+func (n *NativePdptwSolver) GetRTH() []common.Location {
+	return n.rth
+}
+
+func (n *NativePdptwSolver) SetInitialSchedule(s Schedule) {
+	n.initial_schedule = s
+}
+
+func (n *NativePdptwSolver) SetTravelTimeMatrixPath(p string) {
+	n.travel_time_matrix_path = p
+}
+
+func (n *NativePdptwSolver) GetTravelTimeMatrixPath() string {
+	return n.travel_time_matrix_path
+}
+
+func (n *NativePdptwSolver) Set(im, uim common.InterestMap, v []common.Vehicle, b, c int, r []common.Location) {
+	n.interest_map = im
+	n.unweighted_interest_map = uim
+	n.vehicles = v
+	n.budget = b
+	n.capacity = c
+	n.rth = r
+}
+
+// check if task has a destination (i.e., is a pickup-and-delivery request)
+func has_destination(t common.Task) bool {
+	return t.Destination != (common.Location{}) &&
+		t.Destination.Latitude != common.INVALID_LOC &&
+		t.Destination.Longitude != common.INVALID_LOC
+}
+
+// delivery task of request, as keyed in PdptwSolver node_map
+func delivery_task(d common.TaskData) common.TaskData {
+	return common.TaskData{
+		AppID:       d.AppID,
+		Location:    d.Destination,
+		Destination: common.Location{Latitude: common.INVALID_LOC, Longitude: common.INVALID_LOC},
+		RequestTime: d.RequestTime,
+	}
+}
+
+// state of native pickup-and-delivery search: routes carry no interest
+// capacity (route capacity is 0), load is number of requests on board
+type native_pd_state struct {
+	native_state
+	// other node of request (-1 if task has no destination)
+	partner []int
+	// node is a delivery
+	delivery []bool
+	// max requests on board, per route (0 if unlimited)
+	capacity []int
+}
+
+// check precedence (pickup before delivery, both on path) and load
+func (ps *native_pd_state) paired(ri int, path []int) bool {
+	seen := make(map[int]bool, len(path))
+	var load int
+	for _, idx := range path {
+		seen[idx] = true
+		if ps.partner[idx] < 0 {
+			continue
+		}
+		if ps.delivery[idx] {
+			if !seen[ps.partner[idx]] {
+				return false
+			}
+			load -= 1
+			continue
+		}
+		load += 1
+		if ps.capacity[ri] > 0 && load > ps.capacity[ri] {
+			return false
+		}
+	}
+	return load == 0
+}
+
+// check pairing, capacity, budget, allowed app and time window constraints
+func (ps *native_pd_state) feasible(ri int, path []int) bool {
+	return ps.paired(ri, path) && ps.native_state.feasible(&ps.routes[ri], path)
+}
+
+// remove request (pickup and delivery) from path (returns new slice)
+func (ps *native_pd_state) remove_request(path []int, node int) []int {
+	x := make([]int, 0, len(path))
+	for _, idx := range path {
+		if idx != node && idx != ps.partner[node] {
+			x = append(x, idx)
+		}
+	}
+	return x
+}
+
+// cheapest feasible insertion of request (pickup at i, delivery at j >= i)
+// into path of route; ok is false if request fits nowhere
+func (ps *native_pd_state) insert_request(ri int, path []int, node int) ([]int, int, bool) {
+	r := &ps.routes[ri]
+	var best []int
+	var best_time int
+	if !ps.allowed(r, node) {
+		return nil, 0, false
+	}
+	for i := 0; i <= len(path); i++ {
+		x := insert_at(path, node, i)
+		if ps.partner[node] < 0 {
+			if t := ps.path_time(r, x); (best == nil || t < best_time) && ps.feasible(ri, x) {
+				best, best_time = x, t
+			}
+			continue
+		}
+		for j := i + 1; j <= len(x); j++ {
+			y := insert_at(x, ps.partner[node], j)
+			if t := ps.path_time(r, y); (best == nil || t < best_time) && ps.feasible(ri, y) {
+				best, best_time = y, t
+			}
+		}
+	}
+	return best, best_time, best != nil
+}
+
+// set request (pickup and delivery) as routed or not
+func (ps *native_pd_state) route_request(node int, routed bool) {
+	ps.routed[node] = routed
+	if ps.partner[node] >= 0 {
+		ps.routed[ps.partner[node]] = routed
+	}
+}
+
+// seed routes with initial schedule: keep requests whose pickup and
+// delivery are on the same route, in order, while they remain feasible
+func (ps *native_pd_state) warm_start(init Schedule, index map[common.Task]int) {
+	for ri, route := range init.Routes {
+		if ri >= len(ps.routes) {
+			break
+		}
+
+		// position of known, unrouted nodes in initial route
+		var order []int
+		pos := make(map[int]int)
+		for _, t := range route.Path {
+			idx, ok := index[t.GetTask()]
+			if _, dup := pos[idx]; !ok || dup || ps.routed[idx] {
+				continue
+			}
+			pos[idx] = len(order)
+			order = append(order, idx)
+		}
+
+		// add requests in order of pickup
+		kept := make(map[int]bool)
+		for _, idx := range order {
+			if ps.delivery[idx] {
+				continue
+			}
+			if p := ps.partner[idx]; p >= 0 {
+				if at, ok := pos[p]; !ok || at < pos[idx] {
+					continue
+				}
+			}
+			var path []int
+			for _, x := range order {
+				if kept[x] || x == idx || x == ps.partner[idx] {
+					path = append(path, x)
+				}
+			}
+			if !ps.feasible(ri, path) {
+				continue
+			}
+			kept[idx] = true
+			if p := ps.partner[idx]; p >= 0 {
+				kept[p] = true
+			}
+			ps.routes[ri].path = path
+		}
+		for idx := range kept {
+			ps.route_request(idx, true)
+		}
+	}
+}
+
+// greedily insert unrouted requests with best interest per extra second
+func (ps *native_pd_state) insert() bool {
+	improved := false
+	for {
+		best_ratio := -1.0
+		var best_path []int
+		var best_node, best_route int
+		for node := range ps.nodes {
+			if ps.routed[node] || ps.delivery[node] || ps.nodes[node].weight <= 0 {
+				continue
+			}
+			for ri := range ps.routes {
+				r := &ps.routes[ri]
+				x, t, ok := ps.insert_request(ri, r.path, node)
+				if !ok {
+					continue
+				}
+				delta := t - ps.path_time(r, r.path)
+				if delta < 0 {
+					delta = 0
+				}
+				ratio := ps.nodes[node].weight / float64(1+delta)
+				if ratio > best_ratio {
+					best_ratio = ratio
+					best_path, best_node, best_route = x, node, ri
+				}
+			}
+		}
+		if best_ratio < 0 {
+			return improved
+		}
+		ps.routes[best_route].path = best_path
+		ps.route_request(best_node, true)
+		improved = true
+	}
+}
+
+// move a request to another position (or route) when it saves time
+func (ps *native_pd_state) relocate() bool {
+	for ai := range ps.routes {
+		a := &ps.routes[ai]
+		for _, node := range a.path {
+			if ps.delivery[node] {
+				continue
+			}
+			pa := ps.remove_request(a.path, node)
+			if !ps.feasible(ai, pa) {
+				continue
+			}
+			before_a := ps.path_time(a, a.path)
+			after_a := ps.path_time(a, pa)
+			for bi := range ps.routes {
+				b := &ps.routes[bi]
+
+				// move within same route
+				if bi == ai {
+					if x, t, ok := ps.insert_request(ai, pa, node); ok && t < before_a {
+						a.path = x
+						return true
+					}
+					continue
+				}
+
+				// move to other route
+				before_b := ps.path_time(b, b.path)
+				if x, t, ok := ps.insert_request(bi, b.path, node); ok && after_a+t < before_a+before_b {
+					a.path = pa
+					b.path = x
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// replace a routed request with a more valuable unrouted request
+func (ps *native_pd_state) swap_in() bool {
+	for ri := range ps.routes {
+		r := &ps.routes[ri]
+		for _, old := range r.path {
+			if ps.delivery[old] {
+				continue
+			}
+			pa := ps.remove_request(r.path, old)
+			for node := range ps.nodes {
+				if ps.routed[node] || ps.delivery[node] || ps.nodes[node].weight <= ps.nodes[old].weight {
+					continue
+				}
+				if x, _, ok := ps.insert_request(ri, pa, node); ok {
+					r.path = x
+					ps.route_request(old, false)
+					ps.route_request(node, true)
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// build search state (no routed nodes), with index of nodes by task
+// (pickup by task, delivery by delivery task), and unweighted InterestMap
+func (n *NativePdptwSolver) state() (native_pd_state, map[common.Task]int, common.InterestMap) {
+	uim := n.unweighted_interest_map
+	if uim == nil {
+		uim = n.interest_map
+	}
+
+	// build node list in canonical order; delivery follows its pickup,
+	// and carries no interest
+	var ps native_pd_state
+	ps.timed = travel_model_timed()
+	index := make(map[common.Task]int)
+	for _, t := range n.interest_map.GetTasks() {
+		d := n.interest_map[t]
+		value := d.Interest
+		if u, ok := uim[t]; ok {
+			value = u.Interest
+		}
+		idx := len(ps.nodes)
+		ps.nodes = append(ps.nodes, native_node{data: d, weight: d.Interest, value: value})
+		ps.partner = append(ps.partner, -1)
+		ps.delivery = append(ps.delivery, false)
+		ps.timed = ps.timed || has_window(d)
+		index[t] = idx
+		if !has_destination(t) {
+			continue
+		}
+		dropoff := delivery_task(d)
+		ps.nodes = append(ps.nodes, native_node{data: dropoff})
+		ps.partner[idx] = idx + 1
+		ps.partner = append(ps.partner, idx)
+		ps.delivery = append(ps.delivery, true)
+		index[dropoff.GetTask()] = idx + 1
+	}
+	ps.routed = make([]bool, len(ps.nodes))
+
+	// one route per vehicle (with its own limits), ending at home if RTH
+	ps.routes = make([]native_route, len(n.vehicles))
+	ps.capacity = make([]int, len(n.vehicles))
+	for i, v := range n.vehicles {
+		ps.routes[i].vehicle = v
+		ps.routes[i].budget = v.GetBudget(n.budget)
+		ps.capacity[i] = v.GetCapacity(n.capacity)
+		if n.rth != nil {
+			ps.routes[i].home = &n.rth[i]
+		}
+	}
+	return ps, index, uim
+}
+
+// search stops early (returning best schedule so far) if context is done
+func (n *NativePdptwSolver) Solve(ctx context.Context) (Schedule, error) {
+	if err := ctx.Err(); err != nil {
+		return Schedule{}, err
+	}
+	ps, index, uim := n.state()
+
+	// construct: warm start, then insertion
+	ps.warm_start(n.initial_schedule, index)
+	ps.insert()
+
+	// improve: move requests to free up time, then insert more requests
+	iterations := n.MaxIterations
+	if iterations <= 0 {
+		iterations = NATIVE_MAX_ITERATIONS
+	}
+	for it := 0; it < iterations && ctx.Err() == nil; it++ {
+		improved := false
+		if ps.relocate() {
+			improved = true
+		}
+		if ps.swap_in() {
+			improved = true
+		}
+		if ps.insert() {
+			improved = true
+		}
+		if !improved {
+			break
+		}
+	}
+
+	schedule := ps.to_schedule(uim)
+	schedule.annotate_windows(n.interest_map)
+	return schedule, nil
+}
@@ -0,0 +1,252 @@
+package vrp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+// location dlat degrees north of home; 0.01 is about 112 s at 10 m/s
+func native_loc(dlat float64) common.Location {
+	return common.Location{Latitude: 42.36 + dlat, Longitude: -71.09}
+}
+
+// interest map of tasks (keyed by their task)
+func native_map(tasks ...common.TaskData) common.InterestMap {
+	im := make(common.InterestMap)
+	for _, d := range tasks {
+		im[d.GetTask()] = d
+	}
+	return im
+}
+
+func native_vehicle(id int, dlat float64) common.Vehicle {
+	return common.Vehicle{ID: id, Location: native_loc(dlat), Speed: 10}
+}
+
+func native_solve(t *testing.T, s Solver) Schedule {
+	schedule, err := s.Solve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schedule
+}
+
+func TestNativeInsertWithinBudget(t *testing.T) {
+	im := native_map(
+		common.TaskData{AppID: 1, Location: native_loc(0), Interest: 1},
+		common.TaskData{AppID: 1, Location: native_loc(0.01), Interest: 1},
+		common.TaskData{AppID: 2, Location: native_loc(0.02), Interest: 1},
+	)
+	v := []common.Vehicle{native_vehicle(0, 0)}
+
+	s := native_solve(t, NewNativeSolver(im, im, v, 150, 0, nil))
+	if s.Allocation[1] != 2 || s.Allocation[2] != 0 {
+		t.Errorf("budget 150: got allocation %v, want 2 tasks of app 1", s.Allocation)
+	}
+	if s.Routes[0].TotalTime > 150 {
+		t.Errorf("route takes %d s, over budget", s.Routes[0].TotalTime)
+	}
+
+	s = native_solve(t, NewNativeSolver(im, im, v, 300, 0, nil))
+	if s.Allocation[1] != 2 || s.Allocation[2] != 1 {
+		t.Errorf("budget 300: got allocation %v, want all tasks", s.Allocation)
+	}
+}
+
+// capacity caps unweighted interest of route (vehicle overrides global)
+func TestNativeCapacity(t *testing.T) {
+	im := native_map(
+		common.TaskData{AppID: 1, Location: native_loc(0), Interest: 1},
+		common.TaskData{AppID: 1, Location: native_loc(0.001), Interest: 1},
+		common.TaskData{AppID: 1, Location: native_loc(0.002), Interest: 1},
+	)
+	v := []common.Vehicle{native_vehicle(0, 0)}
+	s := native_solve(t, NewNativeSolver(im, im, v, 1000, 2, nil))
+	if s.Allocation[1] != 2 {
+		t.Errorf("capacity 2: got allocation %v", s.Allocation)
+	}
+
+	v[0].Capacity = 1
+	s = native_solve(t, NewNativeSolver(im, im, v, 1000, 2, nil))
+	if s.Allocation[1] != 1 {
+		t.Errorf("vehicle capacity 1: got allocation %v", s.Allocation)
+	}
+}
+
+func TestNativeTimeWindows(t *testing.T) {
+	v := []common.Vehicle{native_vehicle(0, 0)}
+
+	// window closes before vehicle arrives
+	im := native_map(common.TaskData{AppID: 1, Location: native_loc(0.01), Interest: 1, Latest: 100})
+	s := native_solve(t, NewNativeSolver(im, im, v, 1000, 0, nil))
+	if len(s.Routes[0].Path) != 0 {
+		t.Errorf("served task after its window closed: %v", s.Routes[0].Path)
+	}
+
+	// vehicle waits for window to open
+	im = native_map(common.TaskData{AppID: 1, Location: native_loc(0.01), Interest: 1, Earliest: 500})
+	s = native_solve(t, NewNativeSolver(im, im, v, 1000, 0, nil))
+	if len(s.Routes[0].Path) != 1 {
+		t.Fatalf("got %d tasks, want 1", len(s.Routes[0].Path))
+	}
+	if ft := s.Routes[0].Path[0].FulfillTime; ft < 500 {
+		t.Errorf("fulfilled at %d, before window opens at 500", ft)
+	}
+
+	// waiting counts toward budget
+	s = native_solve(t, NewNativeSolver(im, im, v, 400, 0, nil))
+	if len(s.Routes[0].Path) != 0 {
+		t.Errorf("served task past budget: %v", s.Routes[0].Path)
+	}
+}
+
+// return home counts toward budget, and route ends at home
+func TestNativeRTH(t *testing.T) {
+	im := native_map(common.TaskData{AppID: 1, Location: native_loc(0.01), Interest: 1})
+	v := []common.Vehicle{native_vehicle(0, 0)}
+	home := []common.Location{native_loc(0)}
+
+	s := native_solve(t, NewNativeSolver(im, im, v, 150, 0, nil))
+	if len(s.Routes[0].Path) != 1 {
+		t.Errorf("without RTH: got %d tasks, want 1", len(s.Routes[0].Path))
+	}
+	s = native_solve(t, NewNativeSolver(im, im, v, 150, 0, home))
+	if len(s.Routes[0].Path) != 0 {
+		t.Errorf("with RTH: served task it cannot return from")
+	}
+
+	s = native_solve(t, NewNativeSolver(im, im, v, 300, 0, home))
+	if len(s.Routes[0].Path) != 1 {
+		t.Fatalf("with RTH: got %d tasks, want 1", len(s.Routes[0].Path))
+	}
+	if s.Routes[0].VehicleEnd != home[0] {
+		t.Errorf("route ends at %v, want home", s.Routes[0].VehicleEnd)
+	}
+	if tt := s.Routes[0].TotalTime; tt < 200 {
+		t.Errorf("total time %d does not include return home", tt)
+	}
+}
+
+// search state for vehicles at home and 0.02 north, with paths
+func native_test_state(t *testing.T, im common.InterestMap, budget int, paths ...[]common.TaskData) native_state {
+	v := []common.Vehicle{native_vehicle(0, 0), native_vehicle(1, 0.02)}
+	n := NewNativeSolver(im, im, v[:len(paths)], budget, 0, nil)
+	ns, index, _ := n.state()
+	for ri, path := range paths {
+		for _, d := range path {
+			idx, ok := index[d.GetTask()]
+			if !ok {
+				t.Fatalf("unknown task %v", d)
+			}
+			ns.routes[ri].path = append(ns.routes[ri].path, idx)
+			ns.routed[idx] = true
+		}
+	}
+	return ns
+}
+
+// locations of tasks on path
+func native_path(ns native_state, ri int) []common.Location {
+	var locs []common.Location
+	for _, idx := range ns.routes[ri].path {
+		locs = append(locs, ns.nodes[idx].data.Location)
+	}
+	return locs
+}
+
+func TestNativeRelocate(t *testing.T) {
+	far := common.TaskData{AppID: 1, Location: native_loc(0.02), Interest: 1}
+	im := native_map(far)
+	ns := native_test_state(t, im, 1000, []common.TaskData{far}, nil)
+	if !ns.relocate() {
+		t.Fatal("task not moved to vehicle next to it")
+	}
+	if len(ns.routes[0].path) != 0 || len(ns.routes[1].path) != 1 {
+		t.Errorf("got paths %v and %v", native_path(ns, 0), native_path(ns, 1))
+	}
+	if ns.relocate() {
+		t.Error("relocated task again")
+	}
+}
+
+func TestNativeExchange(t *testing.T) {
+	near := common.TaskData{AppID: 1, Location: native_loc(0), Interest: 1}
+	far := common.TaskData{AppID: 1, Location: native_loc(0.02), Interest: 1}
+	im := native_map(near, far)
+	ns := native_test_state(t, im, 1000, []common.TaskData{far}, []common.TaskData{near})
+	if !ns.exchange() {
+		t.Fatal("tasks not swapped between vehicles")
+	}
+	if p := native_path(ns, 0); len(p) != 1 || p[0] != near.Location {
+		t.Errorf("vehicle 0 got path %v", p)
+	}
+	if p := native_path(ns, 1); len(p) != 1 || p[0] != far.Location {
+		t.Errorf("vehicle 1 got path %v", p)
+	}
+}
+
+// budget fits one of two tasks (on opposite sides of vehicle)
+func TestNativeSwapIn(t *testing.T) {
+	low := common.TaskData{AppID: 1, Location: native_loc(-0.008), Interest: 1}
+	high := common.TaskData{AppID: 2, Location: native_loc(0.008), Interest: 5}
+	im := native_map(low, high)
+	ns := native_test_state(t, im, 100, []common.TaskData{low})
+	if ns.insert() {
+		t.Fatal("inserted task past budget")
+	}
+	if !ns.swap_in() {
+		t.Fatal("more valuable task not swapped in")
+	}
+	if p := native_path(ns, 0); len(p) != 1 || p[0] != high.Location {
+		t.Errorf("got path %v", p)
+	}
+	s := ns.to_schedule(im)
+	if s.Allocation[1] != 0 || s.Allocation[2] != 5 {
+		t.Errorf("got allocation %v", s.Allocation)
+	}
+}
+
+// each request is delivered after its pickup, by same vehicle, with at
+// most capacity requests on board
+func TestNativePdptwPairsRequests(t *testing.T) {
+	im := native_map(
+		common.TaskData{AppID: 1, Location: native_loc(0), Destination: native_loc(0.01), Interest: 1},
+		common.TaskData{AppID: 1, Location: native_loc(0.001), Destination: native_loc(0.01), Interest: 1, RequestTime: 1},
+	)
+	v := []common.Vehicle{native_vehicle(0, 0)}
+	for _, capacity := range []int{0, 1} {
+		s := native_solve(t, NewNativePdptwSolver(im, im, v, 1000, capacity, nil))
+		if s.Allocation[1] != 2 {
+			t.Errorf("capacity %d: got allocation %v, want both requests", capacity, s.Allocation)
+		}
+		var load, peak int
+		picked := make(map[int]bool)
+		for _, d := range s.Routes[0].Path {
+			if d.Destination.Latitude == common.INVALID_LOC {
+				if !picked[d.RequestTime] {
+					t.Errorf("capacity %d: delivered request %d before pickup", capacity, d.RequestTime)
+				}
+				load--
+				continue
+			}
+			picked[d.RequestTime] = true
+			if load++; load > peak {
+				peak = load
+			}
+		}
+		if load != 0 {
+			t.Errorf("capacity %d: %d requests not delivered", capacity, load)
+		}
+		if capacity > 0 && peak > capacity {
+			t.Errorf("capacity %d: carried %d requests at once", capacity, peak)
+		}
+	}
+
+	// budget too short for delivery: request is not picked up
+	s := native_solve(t, NewNativePdptwSolver(im, im, v, 50, 0, nil))
+	if len(s.Routes[0].Path) != 0 {
+		t.Errorf("picked up requests it cannot deliver: %v", s.Routes[0].Path)
+	}
+}
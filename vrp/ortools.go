@@ -2,9 +2,10 @@ package vrp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/mobius-scheduler/mobius/common"
-	"log"
 	"os"
 	"os/exec"
 )
@@ -20,10 +21,11 @@ type GoogleSolver struct {
 	initial_schedule        Schedule
 	rth                     []common.Location
 	travel_time_matrix_path string
+	pool                    *WorkerPool
 }
 
 func (g *GoogleSolver) New() Solver {
-	return &GoogleSolver{}
+	return &GoogleSolver{pool: g.pool}
 }
 
 func NewGoogleSolver(im, uim common.InterestMap, v []common.Vehicle, b, c int, r []common.Location) *GoogleSolver {
@@ -56,6 +58,11 @@ func (g *GoogleSolver) GetTravelTimeMatrixPath() string {
 	return g.travel_time_matrix_path
 }
 
+// use pool of persistent workers (instead of process per call)
+func (g *GoogleSolver) SetPool(p *WorkerPool) {
+	g.pool = p
+}
+
 func (g *GoogleSolver) Set(im, uim common.InterestMap, v []common.Vehicle, b, c int, r []common.Location) {
 	g.interest_map = im
 	g.unweighted_interest_map = uim
@@ -65,7 +72,12 @@ func (g *GoogleSolver) Set(im, uim common.InterestMap, v []common.Vehicle, b, c
 	g.rth = r
 }
 
-func (g *GoogleSolver) Solve() Schedule {
+func (g *GoogleSolver) Solve(ctx context.Context) (Schedule, error) {
+	tt_path, err := external_matrix_path(g.travel_time_matrix_path, g.interest_map, g.vehicles, g.rth)
+	if err != nil {
+		return Schedule{}, err
+	}
+
 	// create InterestMap, Vehicle JSONs
 	inp := Input{
 		InterestMap:           g.interest_map.ToFile(),
@@ -74,13 +86,24 @@ func (g *GoogleSolver) Solve() Schedule {
 		Budget:                g.budget,
 		Capacity:              g.capacity,
 		InitialSchedule:       g.initial_schedule,
-		TravelTimeMatrixPath:  g.travel_time_matrix_path,
+		TravelTimeMatrixPath:  tt_path,
 		RTH:                   g.rth,
 	}
 	inpj := common.ToJSON(inp)
 
+	// run solver on pooled worker, if available
+	if g.pool != nil {
+		out, err := g.pool.Do(ctx, inpj)
+		if err != nil {
+			return Schedule{}, err
+		}
+		schedule, err := parse_worker_response(out)
+		schedule.annotate_windows(g.interest_map)
+		return schedule, err
+	}
+
 	// run solver
-	cmd := exec.Command("python3", "solvers/vrp_ortools.py")
+	cmd := exec.CommandContext(ctx, "python3", "solvers/vrp_ortools.py")
 	cmd.Dir = common.GetDir()
 	var inpbuf, outbuf bytes.Buffer
 	inpbuf.Write(inpj)
@@ -89,13 +112,14 @@ func (g *GoogleSolver) Solve() Schedule {
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
-		log.Fatalf("[vrp] error running ortools: %v", err)
+		return Schedule{}, fmt.Errorf("[vrp] error running ortools: %v", err)
 	}
 
 	var schedule Schedule
 	if err := json.Unmarshal(outbuf.Bytes(), &schedule); err != nil {
-		log.Fatalf("[vrp] error unmarshaling json to output struct: %v", err)
+		return Schedule{}, fmt.Errorf("[vrp] error unmarshaling json to output struct: %v", err)
 	}
+	schedule.annotate_windows(g.interest_map)
 
-	return schedule
+	return schedule, nil
 }
@@ -2,12 +2,15 @@ package vrp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/mobius-scheduler/mobius/common"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -67,21 +70,43 @@ func (g *PdptwSolver) Set(im, uim common.InterestMap, v []common.Vehicle, b, c i
 	g.rth = r
 }
 
-func (g *PdptwSolver) to_txt() string {
+// header: matrix path; num vehicles, capacity, speed, budget; one row per vehicle
+// node rows: id, app, request time, latitude, longitude, demand, interest,
+// unweighted interest, earliest, pickup id, delivery id, latest
+// (time window applies to pickup; 0 if unset)
+func (g *PdptwSolver) to_txt(tt_path string) (string, error) {
 	var out string
 	var idx int
 	node_map := make(map[common.Task]int)
 
 	// tt matrix path
-	out += fmt.Sprintf("%s\n", g.travel_time_matrix_path)
+	out += fmt.Sprintf("%s\n", tt_path)
 
 	// header
 	out += fmt.Sprintf("%d\t%d\t%0.1f\t%d\n", len(g.vehicles), g.capacity, g.vehicles[0].Speed, g.budget)
 
+	// vehicle header rows: id, capacity, speed, budget, service time
+	// multiplier, allowed apps (comma-separated, -1 if all)
+	for i, v := range g.vehicles {
+		allowed := "-1"
+		if len(v.AllowedApps) > 0 {
+			ids := make([]string, len(v.AllowedApps))
+			for j, id := range v.AllowedApps {
+				ids[j] = strconv.Itoa(id)
+			}
+			allowed = strings.Join(ids, ",")
+		}
+		out += fmt.Sprintf(
+			"%d\t%d\t%0.1f\t%d\t%0.2f\t%s\n",
+			i, v.GetCapacity(g.capacity), v.Speed, v.GetBudget(g.budget),
+			v.ServiceTime(1), allowed,
+		)
+	}
+
 	// vehicles
 	for _, v := range g.vehicles {
 		out += fmt.Sprintf(
-			"%d\t-1\t0\t%0.6f\t%0.6f\t0\t0\t0\t0\t0\t0\n",
+			"%d\t-1\t0\t%0.6f\t%0.6f\t0\t0\t0\t0\t0\t0\t0\n",
 			idx, v.Location.Latitude, v.Location.Longitude,
 		)
 		idx += 1
@@ -89,20 +114,21 @@ func (g *PdptwSolver) to_txt() string {
 
 	// tasks
 	interest := 0.0
-	for k, task := range g.interest_map {
+	for _, k := range g.interest_map.GetTasks() {
+		task := g.interest_map[k]
 		out += fmt.Sprintf(
-			"%d\t%d\t%d\t%0.6f\t%0.6f\t%d\t%0.4f\t%0.4f\t%d\t%d\t%d\n",
+			"%d\t%d\t%d\t%0.6f\t%0.6f\t%d\t%0.4f\t%0.4f\t%d\t%d\t%d\t%d\n",
 			idx, task.AppID, task.RequestTime, task.Location.Latitude, task.Location.Longitude,
-			1, task.Interest, g.unweighted_interest_map[k].Interest, task.FulfillTime, 0, idx+1)
+			1, task.Interest, g.unweighted_interest_map[k].Interest, task.Earliest, 0, idx+1, task.Latest)
 		node_map[k] = idx
 		out += fmt.Sprintf(
-			"%d\t%d\t%d\t%0.6f\t%0.6f\t%d\t%0.4f\t%0.4f\t%d\t%d\t%d\n",
+			"%d\t%d\t%d\t%0.6f\t%0.6f\t%d\t%0.4f\t%0.4f\t%d\t%d\t%d\t%d\n",
 			idx+1, task.AppID, task.RequestTime, task.Destination.Latitude, task.Destination.Longitude,
-			-1, task.Interest, g.unweighted_interest_map[k].Interest, task.FulfillTime, idx, 0)
+			-1, task.Interest, g.unweighted_interest_map[k].Interest, 0, idx, 0, 0)
 		t := common.Task{
 			AppID:       task.AppID,
 			Location:    task.Destination,
-			Destination: common.Location{common.INVALID_LOC, common.INVALID_LOC},
+			Destination: common.Location{Latitude: common.INVALID_LOC, Longitude: common.INVALID_LOC},
 			RequestTime: task.RequestTime,
 		}
 		node_map[t] = idx + 1
@@ -116,11 +142,15 @@ func (g *PdptwSolver) to_txt() string {
 		for i, t := range r.Path {
 			task := t.GetTask()
 			if _, exists := node_map[task]; !exists {
-				log.Fatalf("task %+v invalid", task)
+				return "", fmt.Errorf("[vrp] task %+v invalid", task)
 			}
 
 			if i > 0 && node_map[r.Path[i-1].GetTask()] == node_map[r.Path[i].GetTask()] {
-				log.Fatalf("cannot stay at same node: task %+v --> task %+v", r.Path[i-1], r.Path[i])
+				return "", fmt.Errorf(
+					"[vrp] cannot stay at same node: task %+v --> task %+v",
+					r.Path[i-1],
+					r.Path[i],
+				)
 			}
 
 			if i < len(r.Path)-1 {
@@ -131,15 +161,24 @@ func (g *PdptwSolver) to_txt() string {
 		}
 	}
 
-	return out
+	return out, nil
 }
 
-func (g *PdptwSolver) Solve() Schedule {
+func (g *PdptwSolver) Solve(ctx context.Context) (Schedule, error) {
+	tt_path, err := external_matrix_path(g.travel_time_matrix_path, g.interest_map, g.vehicles, g.rth)
+	if err != nil {
+		return Schedule{}, err
+	}
+
 	// create txt for problem
-	inp := []byte(g.to_txt())
+	txt, err := g.to_txt(tt_path)
+	if err != nil {
+		return Schedule{}, err
+	}
+	inp := []byte(txt)
 
 	// run solver
-	cmd := exec.Command("./solvers/or-tools/bin/pdptw")
+	cmd := exec.CommandContext(ctx, "./solvers/or-tools/bin/pdptw")
 	cmd.Dir = common.GetDir()
 	var inpbuf, outbuf bytes.Buffer
 	inpbuf.Write(inp)
@@ -149,15 +188,16 @@ func (g *PdptwSolver) Solve() Schedule {
 
 	start := time.Now()
 	if err := cmd.Run(); err != nil {
-		log.Fatalf("[vrp] error running ortools: %v", err)
+		return Schedule{}, fmt.Errorf("[vrp] error running ortools: %v", err)
 	}
 	end := time.Now()
 	log.Debugf("[vrp] solver took %v seconds", end.Sub(start).Seconds())
 
 	var schedule Schedule
 	if err := json.Unmarshal(outbuf.Bytes(), &schedule); err != nil {
-		log.Fatalf("[vrp] error unmarshaling json to output struct: %v", err)
+		return Schedule{}, fmt.Errorf("[vrp] error unmarshaling json to output struct: %v", err)
 	}
+	schedule.annotate_windows(g.interest_map)
 
-	return schedule
+	return schedule, nil
 }
@@ -0,0 +1,176 @@
+package vrp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/common"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// long-running solver subprocess
+type worker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// pool of long-running solver subprocesses
+// each worker handles one request at a time; requests and responses
+// are streamed over stdin/stdout, one (compact) JSON document per line
+type WorkerPool struct {
+	name  string
+	args  []string
+	dir   string
+	slots chan *worker
+}
+
+// create pool of (at most) size workers running command name
+// workers are started lazily, and restarted if they fail
+func NewWorkerPool(size int, dir, name string, args ...string) *WorkerPool {
+	if size < 1 {
+		size = 1
+	}
+	p := &WorkerPool{
+		name:  name,
+		args:  args,
+		dir:   dir,
+		slots: make(chan *worker, size),
+	}
+	for i := 0; i < size; i++ {
+		p.slots <- nil
+	}
+	return p
+}
+
+// pool of ORTools VRP solvers (vrp_ortools.py in serve mode)
+func NewOrtoolsPool(size int) *WorkerPool {
+	return NewWorkerPool(size, common.GetDir(), "python3", "solvers/vrp_ortools.py", "--serve")
+}
+
+// start solver subprocess
+func (p *WorkerPool) spawn() (*worker, error) {
+	cmd := exec.Command(p.name, p.args...)
+	cmd.Dir = p.dir
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	log.Debugf("[vrp] started solver worker %s (pid %d)", p.name, cmd.Process.Pid)
+	return &worker{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// stop solver subprocess
+func (w *worker) kill() {
+	w.stdin.Close()
+	w.cmd.Process.Kill()
+	w.cmd.Wait()
+}
+
+// write request (as single line) to worker
+func (p *WorkerPool) write(w *worker, req []byte) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, req); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := w.stdin.Write(buf.Bytes())
+	return err
+}
+
+// read response line from worker
+func (p *WorkerPool) read(w *worker) ([]byte, error) {
+	return w.stdout.ReadBytes('\n')
+}
+
+// send request to an idle worker and wait for response
+// if context is done first, the worker is killed (and later restarted)
+func (p *WorkerPool) Do(ctx context.Context, req []byte) ([]byte, error) {
+	var w *worker
+	select {
+	case w = <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if w == nil {
+		var err error
+		if w, err = p.spawn(); err != nil {
+			p.slots <- nil
+			return nil, fmt.Errorf("[vrp] error starting solver worker: %v", err)
+		}
+	}
+
+	type result struct {
+		resp []byte
+		err  error
+	}
+	c := make(chan result, 1)
+	go func() {
+		if err := p.write(w, req); err != nil {
+			c <- result{err: err}
+			return
+		}
+		resp, err := p.read(w)
+		c <- result{resp: resp, err: err}
+	}()
+
+	select {
+	case r := <-c:
+		if r.err != nil {
+			w.kill()
+			p.slots <- nil
+			return nil, fmt.Errorf("[vrp] error communicating with solver worker: %v", r.err)
+		}
+		p.slots <- w
+		return r.resp, nil
+	case <-ctx.Done():
+		w.kill()
+		<-c
+		p.slots <- nil
+		return nil, ctx.Err()
+	}
+}
+
+// stop all workers (waits for busy workers to finish)
+func (p *WorkerPool) Close() {
+	for i := 0; i < cap(p.slots); i++ {
+		if w := <-p.slots; w != nil {
+			w.kill()
+		}
+	}
+}
+
+// unmarshal worker response into schedule
+// workers report failures as {"error": "..."}
+func parse_worker_response(resp []byte) (Schedule, error) {
+	var status struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &status); err != nil {
+		return Schedule{}, fmt.Errorf("[vrp] error unmarshaling json to output struct: %v", err)
+	}
+	if status.Error != "" {
+		return Schedule{}, errors.New("[vrp] solver worker error: " + status.Error)
+	}
+
+	var schedule Schedule
+	if err := json.Unmarshal(resp, &schedule); err != nil {
+		return Schedule{}, fmt.Errorf("[vrp] error unmarshaling json to output struct: %v", err)
+	}
+	return schedule, nil
+}
@@ -1,8 +1,9 @@
 package vrp
 
 import (
+	"context"
 	"github.com/mobius-scheduler/mobius/common"
-	log "github.com/sirupsen/logrus"
+	"github.com/mobius-scheduler/mobius/fairness"
 	"math"
 	"sort"
 )
@@ -15,6 +16,8 @@ type RoiSolver struct {
 	budget                  int
 	unweighted_interest_map common.InterestMap
 	Alpha                   float64
+	Utility                 fairness.Utility
+	Base                    Solver
 }
 
 func (r *RoiSolver) SetInterestMap(im common.InterestMap) {
@@ -43,10 +46,11 @@ func (r *RoiSolver) time_left(et []int) []int {
 	tl := make([]int, len(et))
 	done_count := 0
 	for i, _ := range et {
-		if r.budget >= et[i] {
+		b := r.vehicles[i].GetBudget(r.budget)
+		if b >= et[i] {
 			done_count++
 		}
-		tl[i] = int(math.Max(0, float64(r.budget-et[i])))
+		tl[i] = int(math.Max(0, float64(b-et[i])))
 	}
 
 	if done_count == len(et) {
@@ -57,37 +61,27 @@ func (r *RoiSolver) time_left(et []int) []int {
 }
 
 // initial interest (in order to evaluate utility function)
-const EPSILON = 0.1
+const EPSILON = fairness.EPSILON
 
-// compute alpha-utility
+// objective of greedy solver (alpha-fair utility if unset)
+func (r *RoiSolver) objective() fairness.Utility {
+	if r.Utility != nil {
+		return r.Utility
+	}
+	return fairness.AlphaFair{Alpha: r.Alpha}
+}
+
+// compute utility of allocation (with task td, if any)
 func (r *RoiSolver) utility(a Allocation, td *common.TaskData) float64 {
-	var u float64
-	if r.Alpha == 1 {
-		for id, x := range a {
-			// incorporate task td
-			if td != nil && td.AppID == id {
-				x += td.Interest
-			}
-			if x > 0 {
-				u += math.Log(x)
-			} else {
-				u += math.Log(EPSILON)
-			}
-		}
-	} else {
-		for id, x := range a {
-			// incorporate task td
-			if td != nil && td.AppID == id {
-				x += td.Interest
-			}
-			if x > 0 {
-				u += math.Pow(x, 1-r.Alpha) / (1 - r.Alpha)
-			} else {
-				u += math.Pow(EPSILON, 1-r.Alpha) / (1 - r.Alpha)
-			}
-		}
+	x := make(map[int]float64)
+	for id, v := range a {
+		x[id] = v
+	}
+	// incorporate task td
+	if td != nil {
+		x[td.AppID] += td.Interest
 	}
-	return u
+	return r.objective().Value(x)
 }
 
 func (r *RoiSolver) reweight_alpha(im common.InterestMap, h Allocation) common.InterestMap {
@@ -95,14 +89,15 @@ func (r *RoiSolver) reweight_alpha(im common.InterestMap, h Allocation) common.I
 	curr_util := r.utility(h, nil)
 	for task, data := range im {
 		next_util := r.utility(h, &data)
-		if curr_util > next_util {
-			log.Fatal("[vrp] curr util > next util in ROI")
-		}
+		// objectives such as Jain's index may decrease with more interest
+		gain := math.Max(0, next_util-curr_util)
 		imw[task] = common.TaskData{
 			AppID:           data.AppID,
 			Location:        data.Location,
-			Interest:        next_util - curr_util,
+			Interest:        gain,
 			TaskTimeSeconds: data.TaskTimeSeconds,
+			Earliest:        data.Earliest,
+			Latest:          data.Latest,
 		}
 	}
 	return imw
@@ -123,23 +118,32 @@ type roi_task struct {
 	roi         float64
 }
 
-func (r *RoiSolver) sort_by_roi(im common.InterestMap, v common.Vehicle) []roi_task {
+// sort tasks by roi for vehicle, departing at time elapsed
+// (tasks whose time window would be missed, or whose app
+// the vehicle may not serve, are skipped)
+func (r *RoiSolver) sort_by_roi(im common.InterestMap, v common.Vehicle, elapsed int) []roi_task {
 	// compute list of tasks with roi
-	tasks := make([]roi_task, len(im))
-	i := 0
-	for task, data := range im {
-		tt := travel_time(v.Location, task.Location, v.Speed, data.TaskTimeSeconds)
+	// (ties are broken by canonical task order)
+	var tasks []roi_task
+	for _, task := range im.GetTasks() {
+		data := im[task]
+		if !v.CanServe(data.AppID) {
+			continue
+		}
+		tt, ok := timed_travel_time(v.Location, data, v, elapsed)
+		if !ok {
+			continue
+		}
 		roi_val := data.Interest / float64(tt)
-		tasks[i] = roi_task{
+		tasks = append(tasks, roi_task{
 			task:        task,
 			travel_time: tt,
 			roi:         roi_val,
-		}
-		i++
+		})
 	}
 
 	// sort tasks by roi
-	sort.Slice(
+	sort.SliceStable(
 		tasks, func(i, j int) bool { return tasks[i].roi > tasks[j].roi },
 	)
 	return tasks
@@ -188,6 +192,9 @@ func (r *RoiSolver) insert_alpha_task(
 		extra_time int
 		idx        int
 	}
+	if !v.CanServe(app_id) {
+		return nil, 0, 0
+	}
 
 	var candidates []insert_task
 	for i := 1; i < len(p); i++ {
@@ -196,14 +203,16 @@ func (r *RoiSolver) insert_alpha_task(
 		mp := midpoint(seg[0].Location, seg[1].Location)
 
 		// find insertable tasks
-		for task, data := range r.interest_map {
+		for _, task := range r.interest_map.GetTasks() {
+			data := r.interest_map[task]
 			_, sched := st[task]
 			if task.AppID == app_id && !sched {
 				tt := travel_time(
 					mp,
 					task.Location,
-					v.Speed,
-					data.TaskTimeSeconds,
+					v,
+					v.ServiceTime(data.TaskTimeSeconds),
+					0,
 				)
 				if tt < tolerance {
 					candidates = append(
@@ -220,7 +229,7 @@ func (r *RoiSolver) insert_alpha_task(
 	}
 
 	// sort by least extra time
-	sort.Slice(
+	sort.SliceStable(
 		candidates,
 		func(i, j int) bool {
 			return candidates[i].extra_time < candidates[j].extra_time
@@ -245,7 +254,10 @@ func (r *RoiSolver) compute_alpha_tasks(p roi_problem) map[common.Task]bool {
 		for elapsed < p.budgets[i] && len(p.interest_map) > 0 {
 			// reweight im, get tasks sorted by roi
 			imw := r.reweight_alpha(p.interest_map, p.historical)
-			tasks_sorted := r.sort_by_roi(imw, v)
+			tasks_sorted := r.sort_by_roi(imw, v, elapsed)
+			if len(tasks_sorted) == 0 {
+				break
+			}
 
 			// find best (feasible) roi task
 			next := find_feasible_task(tasks_sorted, elapsed, p.budgets[i])
@@ -288,14 +300,23 @@ func (r *RoiSolver) compute_alpha_tasks(p roi_problem) map[common.Task]bool {
 	return sched_tasks
 }
 
+// VRP solver used to order tasks (default: ORTools)
+func (r *RoiSolver) base_solver() Solver {
+	if r.Base != nil {
+		return r.Base.New()
+	}
+	return &GoogleSolver{}
+}
+
 // reorder alpha-fair tasks with VRP
-func (r *RoiSolver) reorder_with_vrp(im common.InterestMap, budget int) Schedule {
-	solver := NewGoogleSolver(im, im, r.vehicles, budget, 0, nil)
-	return solver.Solve()
+func (r *RoiSolver) reorder_with_vrp(ctx context.Context, im common.InterestMap, budget int) (Schedule, error) {
+	solver := r.base_solver()
+	solver.Set(im, im, r.vehicles, budget, 0, nil)
+	return solver.Solve(ctx)
 }
 
 // perform final packing, with fair set of tasks
-func (r *RoiSolver) final_pack(ft map[common.Task]bool, fs Schedule) Schedule {
+func (r *RoiSolver) final_pack(ctx context.Context, ft map[common.Task]bool, fs Schedule) (Schedule, error) {
 	// create IM with bias on fair tasks
 	im := make(common.InterestMap)
 	for task, _ := range r.interest_map {
@@ -308,16 +329,17 @@ func (r *RoiSolver) final_pack(ft map[common.Task]bool, fs Schedule) Schedule {
 	}
 
 	// generate packed schedule
-	solver := NewGoogleSolver(im, r.interest_map, r.vehicles, r.budget, 0, nil)
+	solver := r.base_solver()
+	solver.Set(im, r.interest_map, r.vehicles, r.budget, 0, nil)
 	solver.SetInitialSchedule(fs)
-	return solver.Solve()
+	return solver.Solve(ctx)
 }
 
 // compute schedule with ROI
-func (r *RoiSolver) Solve() Schedule {
+func (r *RoiSolver) Solve(ctx context.Context) (Schedule, error) {
 	time_left := make([]int, len(r.vehicles))
 	for i, _ := range time_left {
-		time_left[i] = r.budget
+		time_left[i] = r.vehicles[i].GetBudget(r.budget)
 	}
 
 	// create copy of im
@@ -358,10 +380,14 @@ func (r *RoiSolver) Solve() Schedule {
 		for task, _ := range fair_tasks {
 			imf[task] = r.interest_map[task]
 		}
-		sched = r.reorder_with_vrp(imf, r.budget)
+		var err error
+		sched, err = r.reorder_with_vrp(ctx, imf, r.budget)
+		if err != nil {
+			return Schedule{}, err
+		}
 		time_left = r.time_left(sched.ElapsedTime())
 	}
 
 	// pack schedule with additional tasks
-	return r.final_pack(fair_tasks, sched)
+	return r.final_pack(ctx, fair_tasks, sched)
 }
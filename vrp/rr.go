@@ -1,6 +1,7 @@
 package vrp
 
 import (
+	"context"
 	"github.com/mobius-scheduler/mobius/common"
 	"sort"
 )
@@ -33,36 +34,48 @@ func (r *RoundRobinSolver) Set(im, uim common.InterestMap, v []common.Vehicle, b
 	r.rth = x
 }
 
-func (r *RoundRobinSolver) next_task(v common.Vehicle, im common.InterestMap, app_id int) (common.TaskData, int) {
+// find closest task of app that can be reached within its time window
+// (departing at time t); returns false if there is none
+func (r *RoundRobinSolver) next_task(v common.Vehicle, im common.InterestMap, app_id int, t int) (common.TaskData, int, bool) {
 	ima := im.FilterByApp(app_id)
 	type rr_task struct {
 		task        common.TaskData
 		travel_time int
 	}
 
-	tasks := make([]rr_task, len(ima))
-	i := 0
-	for task, data := range ima {
-		tt := travel_time(v.Location, task.Location, v.Speed, data.TaskTimeSeconds)
-		tasks[i] = rr_task{
+	var tasks []rr_task
+	for _, task := range ima.GetTasks() {
+		data := ima[task]
+		tt, ok := timed_travel_time(v.Location, data, v, t)
+		if !ok {
+			continue
+		}
+		tasks = append(tasks, rr_task{
 			task:        data,
 			travel_time: tt,
-		}
-		i++
+		})
+	}
+	if len(tasks) == 0 {
+		return common.TaskData{}, 0, false
 	}
 
 	// sort tasks by min travel_time
-	sort.Slice(
+	// (ties are broken by canonical task order)
+	sort.SliceStable(
 		tasks, func(i, j int) bool { return tasks[i].travel_time < tasks[j].travel_time },
 	)
-	return tasks[0].task, tasks[0].travel_time
+	return tasks[0].task, tasks[0].travel_time, true
 }
 
-func (r *RoundRobinSolver) travel_time_home(v common.Vehicle, h common.Location, loc common.Location) int {
-	return travel_time(loc, h, v.Speed, 0)
+func (r *RoundRobinSolver) travel_time_home(v common.Vehicle, h common.Location, loc common.Location, t int) int {
+	return travel_time(loc, h, v, 0, t)
 }
 
-func (r *RoundRobinSolver) Solve() Schedule {
+func (r *RoundRobinSolver) Solve(ctx context.Context) (Schedule, error) {
+	if err := ctx.Err(); err != nil {
+		return Schedule{}, err
+	}
+
 	// create copy of im
 	im := make(common.InterestMap)
 	for t, d := range r.interest_map {
@@ -85,33 +98,45 @@ func (r *RoundRobinSolver) Solve() Schedule {
 		var interest float64
 		var time int
 		start := vehicle.Location
+		budget := vehicle.GetBudget(r.budget)
 	out:
-		for time <= r.budget {
+		for time <= budget {
+			found := false
 			for _, app := range app_ids {
-				next, tt := r.next_task(vehicle, im, app)
+				if !vehicle.CanServe(app) {
+					continue
+				}
+				next, tt, ok := r.next_task(vehicle, im, app, time)
+				if !ok {
+					continue
+				}
+				found = true
 				var th int
 				if r.rth != nil {
-					th = r.travel_time_home(vehicle, r.rth[i], next.Location)
+					th = r.travel_time_home(vehicle, r.rth[i], next.Location, time+tt)
 				} else {
 					th = 0
 				}
-				if time+tt+th >= r.budget {
+				if time+tt+th >= budget {
 					break out
 				}
+				time += tt
+				next.FulfillTime = time
 				path = append(path, next)
 				interest += r.interest_map[next.GetTask()].Interest
-				time += tt
 				s.Allocation[app] += r.interest_map[next.GetTask()].Interest
 				vehicle.Location = next.Location
 				delete(im, next.GetTask())
 			}
+			if !found {
+				break
+			}
 		}
-		var end common.Location
+		end := start
 		if r.rth != nil {
-			last := path[len(path)-1].Location
 			end = r.rth[i]
-			time += r.travel_time_home(vehicle, end, last)
-		} else {
+			time += r.travel_time_home(vehicle, end, vehicle.Location, time)
+		} else if len(path) > 0 {
 			end = path[len(path)-1].Location
 		}
 		s.Routes = append(
@@ -126,5 +151,5 @@ func (r *RoundRobinSolver) Solve() Schedule {
 		)
 	}
 	s.Stats.Alpha = -2
-	return s
+	return s, nil
 }
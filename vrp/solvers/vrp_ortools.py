@@ -60,16 +60,44 @@ class VRPSolver:
         self.unweighted_im = unweighted_im
         self.drones = drones
         self.capacity = capacity
-        self.budget = budget + self.capacity * CAPACITY_TASK_BIAS if self.capacity else budget
+
+        # per-vehicle budgets (capped by global budget), biased by capacity
+        def vehicle_budget(d):
+            b = min(d['budget'], budget) if d.get('budget') else budget
+            c = d.get('capacity') or self.capacity
+            return int(b + c * CAPACITY_TASK_BIAS) if self.capacity else int(b)
+
+        self.budgets = [vehicle_budget(d) for d in drones]
+        self.budget = max(self.budgets) if self.budgets else budget
+        # vehicles differ in speed or service time: one matrix per vehicle
+        self.heterogeneous = len(set(
+            (d['speed'], d.get('service_time_multiplier') or 1.0)
+            for d in drones)) > 1
         self.initial_routes = schedule_to_routes(
             initial_schedule) if initial_schedule else None
         self.local_search = local_search
         self.verbose = verbose
         self.rth = rth
         self.dist_mat = dist_mat
+        self.timed = any(t.get('earliest') or t.get('latest')
+                         for t in im.values())
+
+    # task time of vehicle at loc (multiplier does not scale capacity bias)
+    def task_time(self, loc, vehicle):
+        if loc not in self.interest_map:
+            return 0.0
+        t = self.interest_map[loc]
+        bias = t.get('capacity_bias', 0.0)
+        multiplier = self.drones[vehicle].get('service_time_multiplier') or 1.0
+        return (t['task_time_seconds'] - bias) * multiplier + bias
+
+    # check if vehicle may serve tasks of app
+    def can_serve(self, vehicle, app):
+        allowed = self.drones[vehicle].get('allowed_apps')
+        return not allowed or app in allowed
 
     def solve(self, heuristic):
-        def generate_distance_matrix(locs):
+        def generate_distance_matrix(locs, vehicle=0):
             if self.dist_mat == None:
                 dim = len(locs)
 
@@ -83,9 +111,8 @@ class VRPSolver:
                             d[i][j] = 0.0
                         else:
                             dist = utils.travel_time(
-                                locs[i], locs[j], self.drones[0]['speed'],
-                                self.interest_map[locs[j]]['task_time_seconds']
-                                if locs[j] in self.interest_map else 0.0)
+                                locs[i], locs[j], self.drones[vehicle]['speed'],
+                                self.task_time(locs[j], vehicle))
                             d[i][j] = dist
 
                 return d
@@ -101,16 +128,14 @@ class VRPSolver:
                         if locs[i] == (-1, -1, -1, -1) or locs[j] == (-1, -1, -1, -1):
                             d[i][j] = 0.0
                         elif locs[i] == locs[j]:
-                            d[i][j] = self.interest_map[locs[j]]['task_time_seconds'] \
-                                    if locs[j] in self.interest_map else 0.0
+                            d[i][j] = self.task_time(locs[j], vehicle)
                         else:
                             x = self.dist_mat[(locs[i][0:2], locs[j][0:2])]
                             if math.isnan(x):
                                 d[i][j] = 1000000
                             else:
                                 d[i][j] = int(x)
-                            d[i][j] += self.interest_map[locs[j]]['task_time_seconds'] \
-                                    if locs[j] in self.interest_map else 0.0
+                            d[i][j] += self.task_time(locs[j], vehicle)
                
                 return d
 
@@ -122,8 +147,9 @@ class VRPSolver:
             ]
             end = [cells.index((depot[0], depot[1], -1, -1)) for depot in self.rth]\
                 if self.rth else [0 for i in range(len(self.drones))]
+            vehicles = range(len(self.drones)) if self.heterogeneous else [0]
             data = {
-                'distances': generate_distance_matrix(cells),
+                'distances': [generate_distance_matrix(cells, v) for v in vehicles],
                 'num_locations': len(cells),
                 'num_vehicles': len(self.drones),
                 'start_locations': start,
@@ -136,9 +162,7 @@ class VRPSolver:
                 ] for r in initial_routes]
             return data
 
-        def create_distance_callback(manager, data, locs):
-            distances = data['distances']
-
+        def create_distance_callback(manager, distances):
             def distance_callback(src, dst):
                 from_node = manager.IndexToNode(src)
                 to_node = manager.IndexToNode(dst)
@@ -146,16 +170,43 @@ class VRPSolver:
 
             return distance_callback
 
-        def add_distance_dimension(routing, transit_callback_instance,
-                                   num_vehicles):
+        def add_distance_dimension(routing, transit_callbacks):
             distance = 'Distance'
             maximum_distance = int(self.budget)  # seconds
-            routing.AddDimension(
-                transit_callback_instance,
-                0,  # no slack
-                maximum_distance,
-                True,  # start cumul to zero
-                distance)
+            slack = maximum_distance if self.timed else 0  # waiting
+            if len(transit_callbacks) == 1:
+                routing.AddDimensionWithVehicleCapacity(
+                    transit_callbacks[0],
+                    slack,
+                    self.budgets,  # per vehicle
+                    True,  # start cumul to zero
+                    distance)
+            else:
+                routing.AddDimensionWithVehicleTransitAndCapacity(
+                    transit_callbacks,
+                    slack,
+                    self.budgets,
+                    True,
+                    distance)
+            return routing.GetDimensionOrDie(distance)
+
+        def add_time_windows(routing, manager, dimension, cells):
+            # cumul at node is completion time (arc cost includes task time),
+            # so window on start of service is shifted by task time
+            # (longest/shortest over vehicles, so window holds for any vehicle)
+            for node in range(len(cells)):
+                cell = cells[node]
+                if cell not in self.interest_map:
+                    continue
+                t = self.interest_map[cell]
+                if not t.get('earliest') and not t.get('latest'):
+                    continue
+                service = [int(self.task_time(cell, v)) for v in range(len(self.drones))]
+                earliest = t.get('earliest', 0) + max(service)
+                latest = t['latest'] + min(service) if t.get('latest') \
+                    else int(self.budget)
+                dimension.CumulVar(manager.NodeToIndex(node)).SetRange(
+                    min(earliest, int(self.budget)), min(latest, int(self.budget)))
 
         def parse_solution(data, manager, routing, solution, locs):
             m = generate_distance_matrix(locs)
@@ -197,17 +248,25 @@ class VRPSolver:
                     curr_node = locs[manager.IndexToNode(index)]
 
                     if self.dist_mat:
-                        cost += self.dist_mat[(prev_node[0:2], curr_node[0:2])] \
+                        # matrix holds travel times only (as in distance matrix)
+                        cost += self.dist_mat[(prev_node[0:2], curr_node[0:2])] + \
+                                self.task_time(curr_node, vehicle_id) \
                                 if prev_node != (-1, -1, -1, -1) and \
                                 curr_node != (-1, -1, -1, -1) else 0.0
                     else:
                         cost += utils.travel_time(
                             prev_node, curr_node,
                             self.drones[vehicle_id]['speed'],
-                            self.interest_map[curr_node]['task_time_seconds']
+                            self.task_time(curr_node, vehicle_id)
                             if curr_node[2] != -1 else 0.0) if prev_node != (
                                 -1, -1, -1, -1) and curr_node != (-1, -1, -1, -1) else 0.0
 
+                    # wait at node until its time window opens
+                    if self.timed and curr_node in self.interest_map and \
+                            self.interest_map[curr_node].get('earliest'):
+                        t = self.interest_map[curr_node]
+                        cost = max(cost, t['earliest'] + int(self.task_time(curr_node, vehicle_id)))
+
                 end = manager.IndexToNode(index)
                 routes[vehicle_id]['path'] += [{
                     'location': {'latitude': locs[end][0], 'longitude': locs[end][1]},
@@ -217,9 +276,9 @@ class VRPSolver:
                 }]
 
                 # verify that: route cost is within budget
-                assert cost <= self.budget, \
+                assert cost <= self.budgets[vehicle_id], \
                     "cost {}, ortools cost {}, budget {}, route {}".format(
-                        cost, route_time, self.budget, routes[vehicle_id]['path']
+                        cost, route_time, self.budgets[vehicle_id], routes[vehicle_id]['path']
                     )
                 routes[vehicle_id]['vehicle_start'] = routes[vehicle_id]['path'][
                     0]['location']
@@ -267,16 +326,21 @@ class VRPSolver:
             if self.rth is None:
                 cells = [(-1, -1, -1, -1)] + cells
             data = create_data_model(cells, self.initial_routes)
-            manager = pywrapcp.RoutingIndexManager(len(data['distances']),
+            manager = pywrapcp.RoutingIndexManager(data['num_locations'],
                                                    data['num_vehicles'],
                                                    data['start_locations'],
                                                    data['end_locations'])
             routing = pywrapcp.RoutingModel(manager)
-            distance_callback = create_distance_callback(manager, data, cells)
-
-            transit_callback_index = routing.RegisterTransitCallback(
-                distance_callback)
-            routing.SetArcCostEvaluatorOfAllVehicles(transit_callback_index)
+            transit_callbacks = [
+                routing.RegisterTransitCallback(
+                    create_distance_callback(manager, distances))
+                for distances in data['distances']
+            ]
+            if len(transit_callbacks) == 1:
+                routing.SetArcCostEvaluatorOfAllVehicles(transit_callbacks[0])
+            else:
+                for vehicle_id, callback in enumerate(transit_callbacks):
+                    routing.SetArcCostEvaluatorOfVehicle(callback, vehicle_id)
 
             for node in range(1, len(cells)):
                 cell = cells[node]
@@ -285,8 +349,24 @@ class VRPSolver:
                         [manager.NodeToIndex(node)],
                         int(1e8 * self.interest_map[cell]['interest']))
 
-            add_distance_dimension(routing, transit_callback_index,
-                                   data['num_vehicles'])
+            # restrict tasks to vehicles allowed to serve their app
+            for node in range(1, len(cells)):
+                cell = cells[node]
+                if cell[2] == -1:
+                    continue
+                allowed = [v for v in range(len(self.drones))
+                           if self.can_serve(v, cell[2])]
+                if len(allowed) == len(self.drones):
+                    continue
+                index = manager.NodeToIndex(node)
+                if allowed:
+                    routing.SetAllowedVehiclesForIndex(allowed, index)
+                else:
+                    routing.VehicleVar(index).SetValues([-1])
+
+            dimension = add_distance_dimension(routing, transit_callbacks)
+            if self.timed:
+                add_time_windows(routing, manager, dimension, cells)
 
             # set first solution heuristic
             search_parameters = pywrapcp.DefaultRoutingSearchParameters()
@@ -302,10 +382,11 @@ class VRPSolver:
             else:
                 search_parameters.time_limit.seconds = 10
 
-            # solve using initial solution (if provided), else from scratch
-            if self.initial_routes:
-                initial_solution = routing.ReadAssignmentFromRoutes(
-                    data['initial_routes'], True)
+            # solve using initial solution (if provided and feasible),
+            # else from scratch
+            initial_solution = routing.ReadAssignmentFromRoutes(
+                data['initial_routes'], True) if self.initial_routes else None
+            if initial_solution:
                 assignment = routing.SolveFromAssignmentWithParameters(
                     initial_solution, search_parameters)
             else:
@@ -326,7 +407,8 @@ def convert_im(imj, uim = None):
         #assert(t['request_time'] == 0)
         if uim:
             key = (t['location']['latitude'], t['location']['longitude'], t['app_id'], t['request_time'])
-            t['task_time_seconds'] += CAPACITY_TASK_BIAS * uim[key]['interest']
+            t['capacity_bias'] = CAPACITY_TASK_BIAS * uim[key]['interest']
+            t['task_time_seconds'] += t['capacity_bias']
         im[(t['location']['latitude'], t['location']['longitude'], \
                 t['app_id'], t['request_time'])] = t
     return im
@@ -354,11 +436,14 @@ def run_solver(heuristic, im, v, b, cap, uim, dist, init, rth):
     )
     return solver.solve(heuristic)
 
-if __name__ == '__main__':
-    # read JSON-ized input from stdin
-    inp = json.loads(sys.stdin.read())
+def solve(inp, pool):
     capacity = inp['capacity'] if inp['capacity'] > 0 else None
     unweighted_im = convert_im(inp['unweighted_interest_map']) if inp['unweighted_interest_map'] else im
+
+    # per-vehicle capacities without global capacity:
+    # vehicles without their own capacity are unconstrained
+    if not capacity and any(v.get('capacity') for v in inp['vehicles']):
+        capacity = int(math.ceil(sum(t['interest'] for t in unweighted_im.values()))) + 1
     im = convert_im(inp['interest_map'], unweighted_im if capacity else None)
     initial_schedule = inp['initial_schedule'] if inp['initial_schedule']['routes'] else None
     if inp['rth']:
@@ -377,7 +462,6 @@ if __name__ == '__main__':
     
     # run different first solution heuristics in parallel
     # choose most efficient solution
-    pool = mp.Pool(processes = mp.cpu_count())
     inputs = [\
             (handler, im, inp['vehicles'], inp['budget'], capacity, unweighted_im, dist_mat, initial_schedule, rth)\
             for _, handler in FIRST_SOLUTION_HEURISTICS.items()]
@@ -394,7 +478,23 @@ if __name__ == '__main__':
     best_schedule = routes[best[0]]
     interests, _ = utils.get_schedule_stats(unweighted_im, best_schedule) if unweighted_im \
         else utils.get_schedule_stats(im, best_schedule)
-    sched = {'routes': best_schedule, 'allocation': interests}
-    
-    print(json.dumps(sched))
+    return {'routes': best_schedule, 'allocation': interests}
 
+if __name__ == '__main__':
+    pool = mp.Pool(processes = mp.cpu_count())
+
+    if '--serve' in sys.argv[1:]:
+        # persistent worker: one JSON input per line on stdin,
+        # one JSON schedule (or error) per line on stdout
+        for line in sys.stdin:
+            if not line.strip():
+                continue
+            try:
+                sched = solve(json.loads(line), pool)
+            except Exception as e:
+                sched = {'error': repr(e)}
+            print(json.dumps(sched), flush=True)
+    else:
+        # read JSON-ized input from stdin
+        inp = json.loads(sys.stdin.read())
+        print(json.dumps(solve(inp, pool)))
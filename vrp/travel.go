@@ -0,0 +1,307 @@
+package vrp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mobius-scheduler/mobius/common"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+// model of travel between locations, shared by all solvers
+type TravelModel interface {
+	// travel time (seconds) of vehicle from src to dst, departing at time t
+	// (seconds since start of run)
+	Duration(src, dst common.Location, v common.Vehicle, t int) float64
+	// distance (meters) from src to dst
+	Distance(src, dst common.Location) float64
+}
+
+// current travel model, and start of current planning round
+// (set once at startup, and between rounds)
+var travel = struct {
+	sync.RWMutex
+	model TravelModel
+	start int
+}{model: Equirectangular{}}
+
+// set travel model used by all solvers (default: equirectangular)
+func SetTravelModel(m TravelModel) {
+	travel.Lock()
+	defer travel.Unlock()
+	travel.model = m
+}
+
+func GetTravelModel() TravelModel {
+	travel.RLock()
+	defer travel.RUnlock()
+	return travel.model
+}
+
+// set time (since start of run) at which current planning round starts;
+// solvers plan in time relative to start of round
+func SetTravelClock(t int) {
+	travel.Lock()
+	defer travel.Unlock()
+	travel.start = t
+}
+
+// travel time of vehicle from src to dst, departing t seconds into round
+func travel_duration(src, dst common.Location, v common.Vehicle, t int) float64 {
+	travel.RLock()
+	defer travel.RUnlock()
+	return travel.model.Duration(src, dst, v, travel.start+t)
+}
+
+// check if external solvers can compute travel times themselves
+// (they implement the default model only)
+func travel_model_builtin() bool {
+	_, ok := GetTravelModel().(Equirectangular)
+	return ok
+}
+
+// check if travel times depend on departure time
+func travel_model_timed() bool {
+	_, ok := GetTravelModel().(*SpeedProfile)
+	return ok
+}
+
+// straight-line distance on flat-earth projection (default)
+type Equirectangular struct{}
+
+func (Equirectangular) Distance(src, dst common.Location) float64 {
+	dx, dy := project(src, dst)
+	return math.Sqrt(math.Pow(dx, 2) + math.Pow(dy, 2))
+}
+
+func (m Equirectangular) Duration(src, dst common.Location, v common.Vehicle, t int) float64 {
+	return m.Distance(src, dst) / v.Speed
+}
+
+// great-circle distance
+type Haversine struct{}
+
+func (Haversine) Distance(src, dst common.Location) float64 {
+	lat1 := src.Latitude * math.Pi / 180
+	lat2 := dst.Latitude * math.Pi / 180
+	dlat := lat2 - lat1
+	dlon := (dst.Longitude - src.Longitude) * math.Pi / 180
+	a := math.Pow(math.Sin(dlat/2), 2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dlon/2), 2)
+	return 2 * EARTH_RADIUS * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func (m Haversine) Duration(src, dst common.Location, v common.Vehicle, t int) float64 {
+	return m.Distance(src, dst) / v.Speed
+}
+
+// distance along north-south and east-west streets (grid)
+type Manhattan struct{}
+
+func (Manhattan) Distance(src, dst common.Location) float64 {
+	dx, dy := project(src, dst)
+	return math.Abs(dx) + math.Abs(dy)
+}
+
+func (m Manhattan) Duration(src, dst common.Location, v common.Vehicle, t int) float64 {
+	return m.Distance(src, dst) / v.Speed
+}
+
+// east-west and north-south offsets (meters) of dst from src
+func project(src, dst common.Location) (float64, float64) {
+	dx := (dst.Longitude - src.Longitude) *
+		math.Cos(0.5*(src.Latitude+dst.Latitude)*math.Pi/180) * math.Pi / 180 * EARTH_RADIUS
+	dy := (dst.Latitude - src.Latitude) * math.Pi / 180 * EARTH_RADIUS
+	return dx, dy
+}
+
+// entry of travel time matrix file, as read by external solvers
+// (ttpath): a JSON list of entries, keyed by location (not by index),
+// with an entry for every ordered pair of locations, including a location
+// with itself; Dropoff is the source and Pickup the destination, and
+// travel time (seconds) excludes task time at the destination
+type TravelMatrixEntry struct {
+	Src        common.Location `json:"Dropoff"`
+	Dst        common.Location `json:"Pickup"`
+	TravelTime float64         `json:"TravelTime"`
+	Distance   float64         `json:"Distance,omitempty"`
+}
+
+type location_pair struct {
+	src, dst common.Location
+}
+
+// precomputed travel times between locations
+// (independent of vehicle; pairs not in matrix use fallback model)
+type TravelMatrix struct {
+	Path      string
+	Fallback  TravelModel
+	durations map[location_pair]float64
+	distances map[location_pair]float64
+}
+
+// load travel time matrix from JSON file
+func LoadTravelMatrix(path string) (*TravelMatrix, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []TravelMatrixEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("[vrp] error parsing travel time matrix %s: %v", path, err)
+	}
+	m := &TravelMatrix{
+		Path:      path,
+		durations: make(map[location_pair]float64),
+		distances: make(map[location_pair]float64),
+	}
+	for _, e := range entries {
+		p := location_pair{e.Src, e.Dst}
+		m.durations[p] = e.TravelTime
+		if e.Distance > 0 {
+			m.distances[p] = e.Distance
+		}
+	}
+	return m, nil
+}
+
+func (m *TravelMatrix) fallback() TravelModel {
+	if m.Fallback != nil {
+		return m.Fallback
+	}
+	return Equirectangular{}
+}
+
+func (m *TravelMatrix) Distance(src, dst common.Location) float64 {
+	if d, ok := m.distances[location_pair{src, dst}]; ok {
+		return d
+	}
+	return m.fallback().Distance(src, dst)
+}
+
+func (m *TravelMatrix) Duration(src, dst common.Location, v common.Vehicle, t int) float64 {
+	if src == dst {
+		return 0
+	}
+	if d, ok := m.durations[location_pair{src, dst}]; ok {
+		return d
+	}
+	return m.fallback().Duration(src, dst, v, t)
+}
+
+// speed factor from a time of day onward
+type SpeedPeriod struct {
+	// seconds after midnight
+	From int `json:"from"`
+	// multiplies speed (e.g., 0.5 in rush hour)
+	Factor float64 `json:"factor"`
+}
+
+// time-of-day dependent speeds on top of a base model
+// (factor is taken at departure time)
+type SpeedProfile struct {
+	Base TravelModel `json:"-"`
+	// time of day (seconds after midnight) at start of run
+	Start   int           `json:"start"`
+	Periods []SpeedPeriod `json:"periods"`
+}
+
+// load speed profile from JSON file
+func LoadSpeedProfile(path string, base TravelModel) (*SpeedProfile, error) {
+	var p SpeedProfile
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("[vrp] error parsing speed profile %s: %v", path, err)
+	}
+	for _, x := range p.Periods {
+		if x.Factor <= 0 {
+			return nil, fmt.Errorf("[vrp] speed profile %s: factor must be positive", path)
+		}
+	}
+	sort.SliceStable(p.Periods, func(i, j int) bool { return p.Periods[i].From < p.Periods[j].From })
+	p.Base = base
+	return &p, nil
+}
+
+// speed factor at time t (seconds since start of run)
+func (p *SpeedProfile) factor(t int) float64 {
+	if len(p.Periods) == 0 {
+		return 1
+	}
+	tod := (p.Start + t) % 86400
+	if tod < 0 {
+		tod += 86400
+	}
+
+	// last period that started before tod (wrapping around midnight)
+	f := p.Periods[len(p.Periods)-1].Factor
+	for _, x := range p.Periods {
+		if x.From > tod {
+			break
+		}
+		f = x.Factor
+	}
+	return f
+}
+
+func (p *SpeedProfile) base() TravelModel {
+	if p.Base != nil {
+		return p.Base
+	}
+	return Equirectangular{}
+}
+
+func (p *SpeedProfile) Distance(src, dst common.Location) float64 {
+	return p.base().Distance(src, dst)
+}
+
+func (p *SpeedProfile) Duration(src, dst common.Location, v common.Vehicle, t int) float64 {
+	return p.base().Duration(src, dst, v, t) / p.factor(t)
+}
+
+// travel times between all (unique) locations, with travel model, for
+// vehicle departing at start of round
+func TravelMatrixEntries(locs []common.Location, v common.Vehicle) []TravelMatrixEntry {
+	var unique []common.Location
+	seen := make(map[common.Location]bool)
+	for _, l := range locs {
+		if !seen[l] {
+			seen[l] = true
+			unique = append(unique, l)
+		}
+	}
+
+	model := GetTravelModel()
+	entries := make([]TravelMatrixEntry, 0, len(unique)*len(unique))
+	for _, src := range unique {
+		for _, dst := range unique {
+			entries = append(entries, TravelMatrixEntry{
+				Src:        src,
+				Dst:        dst,
+				TravelTime: travel_duration(src, dst, v, 0),
+				Distance:   model.Distance(src, dst),
+			})
+		}
+	}
+	return entries
+}
+
+// write travel time matrix between locations to file
+// (in format read by LoadTravelMatrix and external solvers)
+func WriteTravelMatrix(path string, locs []common.Location, v common.Vehicle) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(TravelMatrixEntries(locs, v)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,64 @@
+package vrp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+func close_to(got, want, tol float64) bool {
+	return math.Abs(got-want) <= tol*want
+}
+
+func TestHaversine(t *testing.T) {
+	degree := EARTH_RADIUS * math.Pi / 180
+
+	// one degree along meridian, or along equator
+	origin := common.Location{}
+	if d := (Haversine{}).Distance(origin, common.Location{Latitude: 1}); !close_to(d, degree, 1e-9) {
+		t.Errorf("1° latitude: got %v m, want %v", d, degree)
+	}
+	if d := (Haversine{}).Distance(origin, common.Location{Longitude: 1}); !close_to(d, degree, 1e-9) {
+		t.Errorf("1° longitude at equator: got %v m, want %v", d, degree)
+	}
+
+	// one degree of longitude at 60° north is about half as long
+	src := common.Location{Latitude: 60, Longitude: 10}
+	dst := common.Location{Latitude: 60, Longitude: 11}
+	if d := (Haversine{}).Distance(src, dst); !close_to(d, degree/2, 1e-4) {
+		t.Errorf("1° longitude at 60°: got %v m, want %v", d, degree/2)
+	}
+
+	v := common.Vehicle{Speed: 10}
+	if s := (Haversine{}).Duration(origin, common.Location{Latitude: 1}, v, 0); !close_to(s, degree/10, 1e-9) {
+		t.Errorf("got %v s, want %v", s, degree/10)
+	}
+}
+
+func TestManhattan(t *testing.T) {
+	degree := EARTH_RADIUS * math.Pi / 180
+
+	// along a street, Manhattan and straight-line distances agree
+	src := common.Location{Latitude: 42.36, Longitude: -71.09}
+	dst := common.Location{Latitude: 42.37, Longitude: -71.09}
+	if d, e := (Manhattan{}).Distance(src, dst), (Equirectangular{}).Distance(src, dst); !close_to(d, e, 1e-9) {
+		t.Errorf("along street: got %v m, straight line %v m", d, e)
+	}
+
+	// across a block: sum of east-west and north-south legs
+	src = common.Location{}
+	dst = common.Location{Latitude: 1, Longitude: 1}
+	want := degree + degree*math.Cos(0.5*math.Pi/180)
+	if d := (Manhattan{}).Distance(src, dst); !close_to(d, want, 1e-9) {
+		t.Errorf("across block: got %v m, want %v", d, want)
+	}
+	if d, e := (Manhattan{}).Distance(dst, src), (Equirectangular{}).Distance(dst, src); d <= e {
+		t.Errorf("grid distance %v m not longer than straight line %v m", d, e)
+	}
+
+	v := common.Vehicle{Speed: 10}
+	if s := (Manhattan{}).Duration(src, dst, v, 0); !close_to(s, want/10, 1e-9) {
+		t.Errorf("got %v s, want %v", s, want/10)
+	}
+}
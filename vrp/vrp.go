@@ -1,8 +1,10 @@
 package vrp
 
 import (
+	"context"
 	"fmt"
 	"github.com/mobius-scheduler/mobius/common"
+	"sort"
 )
 
 // schema for route for a single vehicle in schedule
@@ -17,10 +19,20 @@ type Route struct {
 // schema for allocation: app ID --> allocated interest
 type Allocation map[int]float64
 
+// app IDs in allocation, sorted
+func (a Allocation) IDs() []int {
+	ids := make([]int, 0, len(a))
+	for id := range a {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
 func (a Allocation) String() string {
 	out := "{"
-	for id, x := range a {
-		out += fmt.Sprintf("app %d: %0.1f,", id, x)
+	for _, id := range a.IDs() {
+		out += fmt.Sprintf("app %d: %0.1f,", id, a[id])
 	}
 	out += "}"
 	return out
@@ -28,8 +40,8 @@ func (a Allocation) String() string {
 
 func (a Allocation) Total() float64 {
 	var sum float64
-	for _, x := range a {
-		sum += x
+	for _, id := range a.IDs() {
+		sum += a[id]
 	}
 	return sum
 }
@@ -45,7 +57,93 @@ type Schedule struct {
 	} `json:"stats"`
 }
 
-func (s *Schedule) Trim(time int) {
+// copy time windows of tasks in schedule from InterestMap
+// (external solvers do not return them)
+func (s *Schedule) annotate_windows(im common.InterestMap) {
+	for i := range s.Routes {
+		for j, t := range s.Routes[i].Path {
+			if d, ok := im[t.GetTask()]; ok {
+				s.Routes[i].Path[j].Earliest = d.Earliest
+				s.Routes[i].Path[j].Latest = d.Latest
+			}
+		}
+	}
+}
+
+// recompute fulfill times along routes with travel model
+// (external solvers only approximate non-default models,
+// e.g. with a matrix computed at the start of the round)
+func (s *Schedule) retime(vehicles []common.Vehicle) {
+	if travel_model_builtin() {
+		return
+	}
+	for i := range s.Routes {
+		if i >= len(vehicles) {
+			break
+		}
+		r := &s.Routes[i]
+		loc := r.VehicleStart
+		var t int
+		for j := range r.Path {
+			tt, _ := timed_travel_time(loc, r.Path[j], vehicles[i], t)
+			t += tt
+			r.Path[j].FulfillTime = t
+			loc = r.Path[j].Location
+		}
+	}
+}
+
+// copy of routes, with their own paths
+func copy_routes(routes []Route) []Route {
+	if routes == nil {
+		return nil
+	}
+	c := make([]Route, len(routes))
+	for i, r := range routes {
+		c[i] = r
+		c[i].Path = append([]common.TaskData(nil), r.Path...)
+	}
+	return c
+}
+
+// check if path picks up a request without delivering it
+// (delivery keyed as in PdptwSolver node_map)
+func on_board(path []common.TaskData) bool {
+	pending := make(map[common.Task]bool)
+	for _, t := range path {
+		delete(pending, t.GetTask())
+		if has_destination(t.GetTask()) {
+			d := delivery_task(t)
+			pending[d.GetTask()] = true
+		}
+	}
+	return len(pending) > 0
+}
+
+// check if next round (starting at time, with vehicle at last kept task
+// once it is fulfilled) would arrive at next task after its window closes
+func missed_next_round(last, next common.TaskData, v common.Vehicle, time int) bool {
+	if next.Latest <= 0 {
+		return false
+	}
+	free := last.FulfillTime
+	if free < time {
+		free = time
+	}
+	return free+travel_time(last.Location, next.Location, v, 0, free) > next.Latest
+}
+
+// trim schedule to tasks fulfilled by time (plus the task en route)
+// tasks that next round could not reach within their window, and
+// deliveries of requests already picked up, are committed, and kept
+// as well
+// (fulfill times are taken from travel model, with routes
+// indexed like vehicles; vehicles may be nil to use solver's times)
+func (s *Schedule) Trim(time int, vehicles []common.Vehicle) {
+	// trim copy of routes (schedule may share them, e.g. with hull points)
+	s.Routes = copy_routes(s.Routes)
+	s.retime(vehicles)
+
 	// init alloc
 	alloc := make(Allocation)
 	for id, _ := range s.Allocation {
@@ -73,16 +171,56 @@ func (s *Schedule) Trim(time int) {
 			j += 1
 		}
 
+		// keep committed tasks: next round cannot reach them within their
+		// window, or they deliver a request already picked up
+		for j < len(route.Path)-1 {
+			next := route.Path[j+1]
+			committed := i < len(vehicles) && missed_next_round(route.Path[j], next, vehicles[i], time)
+			if !committed && !on_board(route.Path[:j+1]) {
+				break
+			}
+			j += 1
+			t = next
+			if t.Destination.Latitude != common.INVALID_LOC && t.Destination.Longitude != common.INVALID_LOC {
+				alloc[t.AppID] += 1
+			}
+		}
+
 		s.Routes[i].Path = s.Routes[i].Path[:j+1]
 		s.Routes[i].VehicleEnd = t.Location
 		s.Allocation = alloc
 	}
 }
 
+// re-evaluate schedule (e.g., of previous round) for new tasks and
+// vehicles: tasks no longer pending are dropped, routes start at current
+// vehicle positions, and tasks that no longer fit (budget, capacity,
+// windows, allowed apps) are dropped in route order
+// (for pickup-and-delivery solvers, requests are kept or dropped with
+// their deliveries)
+func RemapSchedule(s Schedule, solver Solver, im, uim common.InterestMap, v []common.Vehicle, b, c int, r []common.Location) Schedule {
+	var remapped Schedule
+	switch solver.(type) {
+	case *PdptwSolver, *NativePdptwSolver:
+		n := NewNativePdptwSolver(im, uim, v, b, c, r)
+		ps, index, uim := n.state()
+		ps.warm_start(s, index)
+		remapped = ps.to_schedule(uim)
+	default:
+		n := NewNativeSolver(im, uim, v, b, c, r)
+		ns, index, uim := n.state()
+		ns.warm_start(s, index)
+		remapped = ns.to_schedule(uim)
+	}
+	remapped.Stats.Weights = s.Stats.Weights
+	remapped.Stats.Alpha = s.Stats.Alpha
+	return remapped
+}
+
 func (s Schedule) String() string {
 	out := "schedule has allocation {"
-	for id, a := range s.Allocation {
-		out += fmt.Sprintf("app %d: %0.1f, ", id, a)
+	for _, id := range s.Allocation.IDs() {
+		out += fmt.Sprintf("app %d: %0.1f, ", id, s.Allocation[id])
 	}
 	out += "}"
 	return out
@@ -122,7 +260,7 @@ type Input struct {
 // interface to VRP solvers
 type Solver interface {
 	New() Solver
-	Solve() Schedule
+	Solve(context.Context) (Schedule, error)
 	SetInterestMap(common.InterestMap)
 	GetInterestMap() common.InterestMap
 	GetRTH() []common.Location
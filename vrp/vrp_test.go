@@ -0,0 +1,59 @@
+package vrp
+
+import (
+	"testing"
+
+	"github.com/mobius-scheduler/mobius/common"
+)
+
+// route: vehicle is en route to (and then at) tasks near home until 120,
+// then heads to far task (about 560 s away at 10 m/s), whose window
+// closes at latest; solver's times are kept (default travel model)
+func trim_route(latest int) Schedule {
+	home := common.Location{Latitude: 42.36, Longitude: -71.09}
+	far := common.Location{Latitude: 42.41, Longitude: -71.09}
+	path := []common.TaskData{
+		{AppID: 1, Location: home, Interest: 1, FulfillTime: 100},
+		{AppID: 1, Location: home, Interest: 1, RequestTime: 1, FulfillTime: 120},
+		{AppID: 1, Location: far, Interest: 1, Latest: latest, FulfillTime: 700},
+		{AppID: 1, Location: home, Interest: 1, RequestTime: 2, FulfillTime: 1300},
+	}
+	return Schedule{
+		Routes:     []Route{{Path: path, VehicleStart: home}},
+		Allocation: Allocation{1: 4},
+	}
+}
+
+func TestTrimKeepsTaskUnreachableNextRound(t *testing.T) {
+	v := []common.Vehicle{{ID: 0, Speed: 10}}
+
+	// next round departs from home at 120 at the earliest, arriving
+	// after window closes at 650: task is committed
+	s := trim_route(650)
+	s.Trim(50, v)
+	if n := len(s.Routes[0].Path); n != 3 {
+		t.Fatalf("committed task dropped: got %d tasks, want 3", n)
+	}
+	if s.Routes[0].VehicleEnd != s.Routes[0].Path[2].Location {
+		t.Errorf("vehicle should end at committed task")
+	}
+	committed := s.Allocation[1]
+
+	// window leaves room for next round: task is replanned
+	s = trim_route(2000)
+	s.Trim(50, v)
+	if n := len(s.Routes[0].Path); n != 2 {
+		t.Fatalf("got %d tasks, want 2", n)
+	}
+	if committed != s.Allocation[1]+1 {
+		t.Errorf("committed task should count toward allocation: got %v, want %v", committed, s.Allocation[1]+1)
+	}
+}
+
+func TestTrimWithoutVehiclesIgnoresWindows(t *testing.T) {
+	s := trim_route(650)
+	s.Trim(50, nil)
+	if n := len(s.Routes[0].Path); n != 2 {
+		t.Fatalf("got %d tasks, want 2", n)
+	}
+}